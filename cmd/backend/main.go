@@ -5,13 +5,13 @@ import (
 	"crypto/ed25519"
 	"encoding/hex"
 	"encoding/json"
-	"errors"
 	"github.com/xssnick/ton-provider-web/internal/backend/storage"
 	"github.com/xssnick/tonutils-go/adnl"
 	"github.com/xssnick/tonutils-go/adnl/dht"
 	"github.com/xssnick/tonutils-storage-provider/pkg/transport"
-	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -30,11 +30,52 @@ type Config struct {
 	PrivateKey         []byte `json:"private_key"`
 	VerificationDomain string `json:"verification_domain"`
 	TonConfigURL       string `json:"ton_config_url"`
+	SessionDurationSec uint64 `json:"session_duration_sec"`
+
+	// VerificationDomains are additional TON Connect domains, like staging, mirror or Telegram Mini App host
+	VerificationDomains []string `json:"verification_domains"`
+	// AllowedOrigins are origins (https://example.com) or hostnames allowed to call api from browser,
+	// verification domains are allowed when empty
+	AllowedOrigins []string `json:"allowed_origins"`
 
 	StorageApiAddr     string `json:"storage_api_addr"`
 	StorageApiLogin    string `json:"storage_api_login"`
 	StorageApiPassword string `json:"storage_api_password"`
 	ProviderKeyHex     string `json:"provider_key_hex"`
+	// ProviderKeysHex are additional providers, they are added to the providers registry on start,
+	// admins can add more via api, users can replicate bags to any enabled ones
+	ProviderKeysHex []string `json:"provider_keys_hex"`
+
+	// DefaultPlan limits are applied to every user, zero means unlimited
+	DefaultPlan db.Plan `json:"default_plan"`
+	// PlanOverrides are stored for listed addresses on start, replacing default limits, omitted limit
+	// is taken from the default plan and zero means unlimited. Overrides removed from config are removed on start
+	PlanOverrides map[string]db.PlanOverride `json:"plan_overrides"`
+
+	// AdminAddresses are wallets allowed to use admin api after regular login
+	AdminAddresses []string `json:"admin_addresses"`
+	// AdminKey grants admin api access via X-Admin-Key header, empty disables it
+	AdminKey string `json:"admin_key"`
+
+	// FrontendDir serves web app from disk instead of embedded build, useful for development
+	FrontendDir string `json:"frontend_dir"`
+
+	// TrustedProxies are IPs or CIDRs of reverse proxies, client ip is taken from Forwarded or X-Forwarded-For only behind them
+	TrustedProxies []string `json:"trusted_proxies"`
+	// ProxyHeader is the header which trusted proxies set with client ip: X-Forwarded-For (default), Forwarded or X-Real-IP,
+	// other headers are ignored, because proxy passes them from client as is
+	ProxyHeader string `json:"proxy_header"`
+	// RateLimitByWallet applies rate limits of authorized requests per wallet instead of per ip
+	RateLimitByWallet bool `json:"rate_limit_by_wallet"`
+	// MetricsAddr is a separate listen address for prometheus metrics, when empty they are served on the api address for admins only
+	MetricsAddr string `json:"metrics_addr"`
+
+	// Telegram bot sends expiry alerts to users who linked their chats by sending "/start <code>" to it,
+	// disabled when token is empty. Bot must not have a webhook set, updates are received by polling
+	Telegram backend.TelegramConfig `json:"telegram"`
+	// WebhookDevMode allows http and local addresses for user webhooks, to test delivery with a local stub,
+	// never enable it in production
+	WebhookDevMode bool `json:"webhook_dev_mode"`
 }
 
 const configFile = "./config.json"
@@ -43,6 +84,9 @@ func main() {
 	// Configure logger
 	logger := zerolog.New(zerolog.ConsoleWriter{Out: os.Stdout}).With().Timestamp().Logger()
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// Load or generate configuration
 	cfg, err := loadOrGenerateConfig(configFile, logger)
 	if err != nil {
@@ -54,13 +98,8 @@ func main() {
 	if err != nil {
 		logger.Fatal().Err(err).Msg("Failed to initialize database")
 	}
-	defer func() {
-		if err := database.Close(); err != nil {
-			logger.Error().Err(err).Msg("Failed to close database")
-		}
-	}()
 
-	lsCfg, err := liteclient.GetConfigFromUrl(context.Background(), cfg.TonConfigURL)
+	lsCfg, err := liteclient.GetConfigFromUrl(ctx, cfg.TonConfigURL)
 	if err != nil {
 		logger.Fatal().Err(err).Msg("Failed to load TON config")
 		return
@@ -68,7 +107,7 @@ func main() {
 
 	// TON Connection
 	client := liteclient.NewConnectionPool()
-	err = client.AddConnectionsFromConfig(context.Background(), lsCfg)
+	err = client.AddConnectionsFromConfig(ctx, lsCfg)
 	if err != nil {
 		logger.Fatal().Err(err).Msg("Failed to add connections from TON config")
 		return
@@ -112,34 +151,141 @@ func main() {
 		Password: cfg.StorageApiPassword,
 	}, logger)
 
-	providerKey, err := hex.DecodeString(cfg.ProviderKeyHex)
+	var providerKeys [][]byte
+	for _, keyHex := range append([]string{cfg.ProviderKeyHex}, cfg.ProviderKeysHex...) {
+		providerKey, err := hex.DecodeString(keyHex)
+		if err != nil {
+			logger.Fatal().Err(err).Str("key", keyHex).Msg("Failed to decode provider key")
+			return
+		}
+		if len(providerKey) != 32 {
+			logger.Fatal().Str("key", keyHex).Msg("Provider key must be 32 bytes long")
+			return
+		}
+		providerKeys = append(providerKeys, providerKey)
+
+		if err = database.SeedProvider(db.StorageProvider{Key: providerKey, AddedBy: "config", CreatedAt: time.Now()}); err != nil {
+			logger.Fatal().Err(err).Str("key", keyHex).Msg("Failed to store provider")
+			return
+		}
+	}
+
+	// Plans initialization, default limits are in the generated config, zero limit means unlimited
+	configPlans := map[string]bool{}
+	for addrStr, plan := range cfg.PlanOverrides {
+		addr, err := backend.NormalizeAddress(addrStr)
+		if err != nil {
+			logger.Fatal().Err(err).Str("addr", addrStr).Msg("Invalid address in plan overrides")
+			return
+		}
+
+		plan.Source = db.PlanSourceConfig
+		if err = database.SetUserPlan(addr, plan); err != nil {
+			logger.Fatal().Err(err).Str("addr", addrStr).Msg("Failed to store plan override")
+			return
+		}
+		configPlans[addr] = true
+	}
+
+	storedPlans, err := database.GetUserPlans()
 	if err != nil {
-		logger.Fatal().Err(err).Msg("Failed to decode provider key")
+		logger.Fatal().Err(err).Msg("Failed to get plan overrides")
 		return
 	}
-	if len(providerKey) != 32 {
-		logger.Fatal().Msg("Provider key must be 32 bytes long")
-		return
+	for addr, plan := range storedPlans {
+		// overrides set by admin are kept
+		if plan.Source != db.PlanSourceConfig || configPlans[addr] {
+			continue
+		}
+
+		if err = database.DeleteUserPlan(addr); err != nil {
+			logger.Fatal().Err(err).Str("addr", addr).Msg("Failed to remove plan override")
+			return
+		}
+		logger.Info().Str("addr", addr).Msg("Plan override removed from config, default plan is used")
 	}
 
 	// Service initialization
-	service := backend.NewService(database, api, pcl, providerKey, storageClient, cfg.StorageDir, logger)
+	service := backend.NewService(database, api, pcl, providerKeys[0], storageClient, cfg.StorageDir, cfg.DefaultPlan, backend.NotifyConfig{
+		Telegram:       cfg.Telegram,
+		WebhookDevMode: cfg.WebhookDevMode,
+		DeniedHosts:    []string{cfg.StorageApiAddr},
+	}, logger)
 
 	// TON Connect Verifier initialization
 	sessionDuration := 30 * time.Minute
-	verifier := wallet.NewTonConnectVerifier(cfg.VerificationDomain, sessionDuration, api)
+	if cfg.SessionDurationSec > 0 {
+		sessionDuration = time.Duration(cfg.SessionDurationSec) * time.Second
+	}
+	domains := append([]string{cfg.VerificationDomain}, cfg.VerificationDomains...)
+	verifiers := map[string]*wallet.TonConnectVerifier{}
+	for _, domain := range domains {
+		if domain != "" {
+			verifiers[domain] = wallet.NewTonConnectVerifier(domain, sessionDuration, api)
+		}
+	}
+
+	origins := cfg.AllowedOrigins
+	if len(origins) == 0 {
+		origins = domains
+	}
 
 	// Server initialization
+	serverErr := make(chan error, 1)
 	go func() {
-		err = backend.Listen(ed25519.NewKeyFromSeed(cfg.PrivateKey), cfg.ServerAddr, cfg.VerificationDomain, cfg.MaxFileSize, service, verifier, logger)
-		if err != nil && !errors.Is(err, http.ErrServerClosed) {
-			logger.Fatal().Err(err).Msg("Failed to start server")
-		}
+		serverErr <- backend.Listen(ctx, backend.ServerConfig{
+			Key:               ed25519.NewKeyFromSeed(cfg.PrivateKey),
+			Addr:              cfg.ServerAddr,
+			Origins:           origins,
+			MaxFileSize:       cfg.MaxFileSize,
+			SessionTTL:        sessionDuration,
+			FrontendDir:       cfg.FrontendDir,
+			Admins:            cfg.AdminAddresses,
+			AdminKey:          cfg.AdminKey,
+			TrustedProxies:    cfg.TrustedProxies,
+			ProxyHeader:       cfg.ProxyHeader,
+			RateLimitByWallet: cfg.RateLimitByWallet,
+			MetricsAddr:       cfg.MetricsAddr,
+		}, service, verifiers, logger)
 	}()
 
 	// Service is running
 	logger.Info().Msg("Service initialized and server running")
-	select {} // Keep the main thread alive
+
+	failed := false
+	select {
+	case <-ctx.Done():
+		logger.Info().Msg("Shutdown signal received, draining server")
+		if err = <-serverErr; err != nil {
+			logger.Error().Err(err).Msg("Failed to gracefully stop server")
+		}
+	case err = <-serverErr:
+		logger.Error().Err(err).Msg("Server stopped unexpectedly")
+		failed = true
+	}
+
+	// Let worker finish its current task before closing connections it uses
+	stopCtx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	if err = service.Stop(stopCtx); err != nil {
+		logger.Error().Err(err).Msg("Failed to wait for worker stop")
+	}
+	cancel()
+
+	_ = gw.Close()
+	dhtClient.Close()
+	_ = gwDht.Close()
+	netMgr.Close()
+	client.Stop()
+
+	// Database is closed last, after everything that can write into it is stopped
+	if err = database.Close(); err != nil {
+		logger.Error().Err(err).Msg("Failed to close database")
+	}
+	logger.Info().Msg("Shutdown complete")
+
+	if failed {
+		os.Exit(1)
+	}
 }
 
 func loadOrGenerateConfig(path string, logger zerolog.Logger) (*Config, error) {
@@ -155,14 +301,22 @@ func loadOrGenerateConfig(path string, logger zerolog.Logger) (*Config, error) {
 			DBPath:             "./data/db",
 			StorageDir:         "./data/storage",
 			ServerAddr:         ":8080",
+			MetricsAddr:        "127.0.0.1:9100",
 			MaxFileSize:        512 << 20,
 			PrivateKey:         privateKey.Seed(),
 			VerificationDomain: "example.com",
 			TonConfigURL:       "https://ton-blockchain.github.io/global.config.json",
+			SessionDurationSec: 1800,
 			StorageApiAddr:     "http://127.0.0.1:7711",
 			StorageApiLogin:    "some_login",
 			StorageApiPassword: "some_password",
 			ProviderKeyHex:     "0000000000000000000000000000000000000000000000000000000000000000",
+			DefaultPlan: db.Plan{
+				MaxBytes:      10 << 30,
+				MaxFiles:      100,
+				MaxPending:    3,
+				MaxUploadSize: 512 << 20,
+			},
 		}
 		if err := saveConfig(path, defaultConfig, logger); err != nil {
 			return nil, err
@@ -0,0 +1,20 @@
+// Package frontend embeds built web app into backend binary,
+// run `npm run build` in this directory before building backend to include it.
+package frontend
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed all:dist
+var dist embed.FS
+
+// Dist returns files of the built app, there is no index.html when app was not built
+func Dist() fs.FS {
+	sub, err := fs.Sub(dist, "dist")
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
@@ -0,0 +1,300 @@
+import React, {useEffect, useState} from "react";
+import "./index.css";
+import {ToSz} from "./FileTile.tsx";
+import {Snackbar} from "./Snackbar.tsx";
+
+// Admin console is served at /admin, requests are authorized by admin key when it is entered,
+// otherwise by session of admin wallet logged in on the main page
+const adminKeyStorage = "admin-key";
+const pageSize = 50;
+
+interface AdminUser {
+    address: string;
+    banned: boolean;
+    quota: {
+        custom_plan: boolean;
+        plan: { max_bytes: number; max_files: number; max_pending: number; max_upload_size: number };
+        usage: { bytes: number; files: number; pending: number };
+    };
+}
+
+interface AdminFile {
+    key: string;
+    owner_addr: string;
+    file_name: string;
+    size: number;
+    status: string;
+    bag_id: string;
+    provider_status: string;
+}
+
+interface AdminTask {
+    type: string;
+    key: string;
+    exec_at?: string;
+    force?: boolean;
+}
+
+interface DiskUsage {
+    storage_dir: string;
+    used_bytes: number;
+    upload_bytes: number;
+    free_bytes?: number;
+    total_bytes?: number;
+}
+
+type Tab = "users" | "files" | "tasks" | "disk";
+
+async function adminRequest(path: string, method: string = "GET"): Promise<any> {
+    const headers: Record<string, string> = {"Content-Type": "application/json"};
+    const key = sessionStorage.getItem(adminKeyStorage);
+    if (key) {
+        headers["X-Admin-Key"] = key;
+    }
+
+    const response = await fetch(`/api/v1/admin/${path}`, {method, headers});
+    if (!response.ok) {
+        let message = `${response.status} ${response.statusText}`;
+        try {
+            message = (await response.json()).message || message;
+        } catch {
+            // not a json error
+        }
+        throw new Error(message);
+    }
+
+    if (response.headers.get("Content-Type")?.includes("application/json")) {
+        return response.json();
+    }
+    return null;
+}
+
+const limitText = (v: number, size: boolean): string => v === 0 ? "∞" : (size ? ToSz(v) : String(v));
+
+export const AdminConsole: React.FC = () => {
+    const [adminKey, setAdminKey] = useState(sessionStorage.getItem(adminKeyStorage) || "");
+    const [tab, setTab] = useState<Tab>("users");
+    const [users, setUsers] = useState<AdminUser[]>([]);
+    const [files, setFiles] = useState<AdminFile[]>([]);
+    const [tasks, setTasks] = useState<AdminTask[]>([]);
+    const [disk, setDisk] = useState<DiskUsage | null>(null);
+    // cursors of the loaded pages, last element is the cursor of the current page
+    const [cursors, setCursors] = useState<string[]>([""]);
+    const [userFilter, setUserFilter] = useState("");
+    const [message, setMessage] = useState("");
+
+    const cursor = cursors[cursors.length - 1];
+
+    const load = async () => {
+        try {
+            const after = encodeURIComponent(cursor);
+            switch (tab) {
+                case "users":
+                    setUsers(await adminRequest(`users?limit=${pageSize}&after=${after}`) || []);
+                    break;
+                case "files":
+                    setFiles(await adminRequest(`files?limit=${pageSize}&after=${after}&user=${encodeURIComponent(userFilter)}`) || []);
+                    break;
+                case "tasks":
+                    setTasks(await adminRequest("tasks") || []);
+                    break;
+                case "disk":
+                    setDisk(await adminRequest("disk"));
+                    break;
+            }
+        } catch (e) {
+            setMessage(String(e));
+        }
+    };
+
+    useEffect(() => {
+        load();
+    }, [tab, cursor, userFilter]);
+
+    const switchTab = (t: Tab) => {
+        setCursors([""]);
+        setTab(t);
+    };
+
+    const showUserFiles = (addr: string) => {
+        setCursors([""]);
+        setUserFilter(addr);
+        setTab("files");
+    };
+
+    const saveKey = () => {
+        if (adminKey) {
+            sessionStorage.setItem(adminKeyStorage, adminKey);
+        } else {
+            sessionStorage.removeItem(adminKeyStorage);
+        }
+        load();
+    };
+
+    const act = async (path: string, method: string, done: string) => {
+        try {
+            await adminRequest(path, method);
+            setMessage(done);
+            await load();
+        } catch (e) {
+            setMessage(String(e));
+        }
+    };
+
+    const toggleBan = (u: AdminUser) => {
+        const addr = encodeURIComponent(u.address);
+        if (u.banned) {
+            act(`ban?address=${addr}`, "DELETE", "User unbanned");
+            return;
+        }
+
+        const reason = prompt(`Ban ${u.address}? Reason:`);
+        if (reason === null) return;
+        act(`ban?address=${addr}&reason=${encodeURIComponent(reason)}`, "POST", "User banned");
+    };
+
+    const removeFile = (f: AdminFile) => {
+        if (!confirm(`Force remove ${f.key}? File is removed even if it is stored at provider.`)) return;
+        act(`remove?key=${encodeURIComponent(f.key)}`, "POST", "File removal queued");
+    };
+
+    const requeue = (t: AdminTask) => {
+        act(`tasks/requeue?type=${t.type}&key=${encodeURIComponent(t.key)}`, "POST", "Task requeued");
+    };
+
+    const nextCursor = tab === "users"
+        ? (users.length === pageSize ? users[users.length - 1].address : "")
+        : (files.length === pageSize ? files[files.length - 1].key : "");
+
+    const pager = (
+        <div className="admin-pager">
+            <button className="btn" disabled={cursors.length === 1}
+                    onClick={() => setCursors(cursors.slice(0, -1))}>Prev</button>
+            <button className="btn" disabled={!nextCursor}
+                    onClick={() => setCursors([...cursors, nextCursor])}>Next</button>
+        </div>
+    );
+
+    return (
+        <div className="app">
+            <header className="header">
+                <div>
+                    <h1>TON Provider Admin</h1>
+                </div>
+                <div className="admin-key">
+                    <input type="password" placeholder="Admin key (optional with admin wallet session)"
+                           value={adminKey} onChange={(e) => setAdminKey(e.target.value)}/>
+                    <button className="btn" onClick={saveKey}>Apply</button>
+                </div>
+            </header>
+
+            <div className="admin-tabs">
+                {(["users", "files", "tasks", "disk"] as Tab[]).map((t) => (
+                    <button key={t} className={t === tab ? "admin-tab active" : "admin-tab"}
+                            onClick={() => switchTab(t)}>{t}</button>
+                ))}
+            </div>
+
+            <div className="admin-content">
+                {tab === "users" && (
+                    <>
+                        <table className="admin-table">
+                            <thead>
+                            <tr><th>Address</th><th>Files</th><th>Pending</th><th>Used</th><th>Limit</th><th>Plan</th><th/></tr>
+                            </thead>
+                            <tbody>
+                            {users.map((u) => (
+                                <tr key={u.address} className={u.banned ? "banned" : ""}>
+                                    <td className="mono">
+                                        <a href="#" onClick={(e) => {
+                                            e.preventDefault();
+                                            showUserFiles(u.address);
+                                        }}>{u.address}</a>
+                                    </td>
+                                    <td>{u.quota.usage.files} / {limitText(u.quota.plan.max_files, false)}</td>
+                                    <td>{u.quota.usage.pending} / {limitText(u.quota.plan.max_pending, false)}</td>
+                                    <td>{ToSz(u.quota.usage.bytes)}</td>
+                                    <td>{limitText(u.quota.plan.max_bytes, true)}</td>
+                                    <td>{u.quota.custom_plan ? "custom" : "default"}</td>
+                                    <td>
+                                        <button className="btn" onClick={() => toggleBan(u)}>
+                                            {u.banned ? "Unban" : "Ban"}
+                                        </button>
+                                    </td>
+                                </tr>
+                            ))}
+                            </tbody>
+                        </table>
+                        {pager}
+                    </>
+                )}
+
+                {tab === "files" && (
+                    <>
+                        {userFilter && (
+                            <div className="admin-filter">
+                                Files of <span className="mono">{userFilter}</span>
+                                <button className="btn" onClick={() => showUserFiles("")}>Show all</button>
+                            </div>
+                        )}
+                        <table className="admin-table">
+                            <thead>
+                            <tr><th>Owner</th><th>Name</th><th>Size</th><th>Status</th><th>Provider</th><th/></tr>
+                            </thead>
+                            <tbody>
+                            {files.map((f) => (
+                                <tr key={f.key}>
+                                    <td className="mono">{f.owner_addr}</td>
+                                    <td>{f.file_name}</td>
+                                    <td>{ToSz(f.size)}</td>
+                                    <td>{f.status}</td>
+                                    <td>{f.provider_status}</td>
+                                    <td>
+                                        <button className="btn" onClick={() => removeFile(f)}>Remove</button>
+                                    </td>
+                                </tr>
+                            ))}
+                            </tbody>
+                        </table>
+                        {pager}
+                    </>
+                )}
+
+                {tab === "tasks" && (
+                    <table className="admin-table">
+                        <thead>
+                        <tr><th>Type</th><th>Key</th><th>Exec at</th><th/></tr>
+                        </thead>
+                        <tbody>
+                        {tasks.map((t) => (
+                            <tr key={t.type + t.key}>
+                                <td>{t.type}{t.force ? " (force)" : ""}</td>
+                                <td className="mono">{t.key}</td>
+                                <td>{t.exec_at ? new Date(t.exec_at).toLocaleString() : "now"}</td>
+                                <td>
+                                    <button className="btn" onClick={() => requeue(t)}>Requeue</button>
+                                </td>
+                            </tr>
+                        ))}
+                        </tbody>
+                    </table>
+                )}
+
+                {tab === "disk" && disk && (
+                    <table className="admin-table">
+                        <tbody>
+                        <tr><td>Storage directory</td><td className="mono">{disk.storage_dir}</td></tr>
+                        <tr><td>Used</td><td>{ToSz(disk.used_bytes)}</td></tr>
+                        <tr><td>Uploads in progress</td><td>{ToSz(disk.upload_bytes)}</td></tr>
+                        {disk.total_bytes !== undefined && (
+                            <tr><td>Free</td><td>{ToSz(disk.free_bytes || 0)} of {ToSz(disk.total_bytes)}</td></tr>
+                        )}
+                        </tbody>
+                    </table>
+                )}
+            </div>
+
+            <Snackbar message={message} onClose={() => setMessage("")}/>
+        </div>
+    );
+};
@@ -0,0 +1,224 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"github.com/xssnick/ton-provider-web/internal/backend/db"
+	"strings"
+	"time"
+)
+
+const (
+	TaskStore   = "store"
+	TaskCleanup = "clean"
+	TaskUpdate  = "update"
+)
+
+var ErrUserBanned = errors.New("user is banned")
+var ErrTaskNotFound = errors.New("task or file not found")
+var ErrUnknownTaskType = errors.New("unknown task type")
+
+type AdminFileInfo struct {
+	UserFileInfo
+	Key       string `json:"key"`
+	OwnerAddr string `json:"owner_addr"`
+}
+
+type AdminUserInfo struct {
+	Address string    `json:"address"`
+	Banned  bool      `json:"banned"`
+	Quota   UserQuota `json:"quota"`
+}
+
+type AdminTask struct {
+	Type   string     `json:"type"`
+	Key    string     `json:"key"`
+	ExecAt *time.Time `json:"exec_at,omitempty"`
+	Force  bool       `json:"force,omitempty"`
+}
+
+type AdminBan struct {
+	Address   string    `json:"address"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type DiskUsage struct {
+	StorageDir  string `json:"storage_dir"`
+	UsedBytes   uint64 `json:"used_bytes"`
+	UploadBytes uint64 `json:"upload_bytes"`
+	FreeBytes   uint64 `json:"free_bytes,omitempty"`
+	TotalBytes  uint64 `json:"total_bytes,omitempty"`
+}
+
+// AdminListFiles returns files of all users ordered by key, after is the last key of the previous page
+func (s *Service) AdminListFiles(after string, limit int) ([]AdminFileInfo, error) {
+	files, err := s.db.GetAllFiles(after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve files: %w", err)
+	}
+
+	list := make([]AdminFileInfo, 0, len(files))
+	for i := range files {
+		list = append(list, AdminFileInfo{
+			UserFileInfo: s.toUserFileInfo(&files[i]),
+			Key:          files[i].Key,
+			OwnerAddr:    keyOwner(files[i].Key),
+		})
+	}
+	return list, nil
+}
+
+// AdminListUsers returns users who have files ordered by address, together with limits and usage,
+// after is the last address of the previous page
+func (s *Service) AdminListUsers(after string, limit int) ([]AdminUserInfo, error) {
+	users, err := s.db.GetUsersWithFiles(after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve users: %w", err)
+	}
+
+	list := make([]AdminUserInfo, 0, len(users))
+	for _, owner := range users {
+		quota, err := s.GetQuota(owner)
+		if err != nil {
+			return nil, err
+		}
+
+		banned, err := s.db.IsBanned(owner)
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, AdminUserInfo{
+			Address: owner,
+			Banned:  banned,
+			Quota:   *quota,
+		})
+	}
+	return list, nil
+}
+
+// AdminListTasks returns queued tasks of the given type, or of all types when type is empty
+func (s *Service) AdminListTasks(typ string) ([]AdminTask, error) {
+	switch typ {
+	case "", TaskStore, TaskCleanup, TaskUpdate:
+	default:
+		return nil, ErrUnknownTaskType
+	}
+
+	list := []AdminTask{}
+	if typ == "" || typ == TaskStore {
+		keys, err := s.db.GetPendingStoreTasks()
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve store tasks: %w", err)
+		}
+		for _, key := range keys {
+			list = append(list, AdminTask{Type: TaskStore, Key: key})
+		}
+	}
+
+	if typ == "" || typ == TaskCleanup {
+		tasks, err := s.db.GetAllCleanupTasks()
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve cleanup tasks: %w", err)
+		}
+		for _, task := range tasks {
+			at := task.ExecAt
+			list = append(list, AdminTask{Type: TaskCleanup, Key: task.Key, ExecAt: &at, Force: task.Force})
+		}
+	}
+
+	if typ == "" || typ == TaskUpdate {
+		tasks, err := s.db.GetAllUpdateTasks()
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve update tasks: %w", err)
+		}
+		for _, task := range tasks {
+			at := task.ExecAt
+			list = append(list, AdminTask{Type: TaskUpdate, Key: task.Key, ExecAt: &at})
+		}
+	}
+	return list, nil
+}
+
+// AdminRequeueTask makes task for the file key to be executed on the next worker cycle
+func (s *Service) AdminRequeueTask(typ, key string) error {
+	var err error
+	switch typ {
+	case TaskStore:
+		err = s.db.RequeueStoreTask(key)
+	case TaskCleanup:
+		err = s.db.RequeueCleanupTask(key)
+	case TaskUpdate:
+		err = s.db.RequeueUpdateTask(key)
+	default:
+		return ErrUnknownTaskType
+	}
+
+	if errors.Is(err, db.ErrNotFound) {
+		return ErrTaskNotFound
+	}
+	return err
+}
+
+// AdminRemoveFile force removes file of any user, including stored at provider
+func (s *Service) AdminRemoveFile(key string) error {
+	fi, err := s.db.GetFileByKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to check file existence: %w", err)
+	}
+	if fi == nil {
+		return ErrFileNotFound
+	}
+
+	if err = s.db.CreateCleanTaskByKey(key); err != nil {
+		return fmt.Errorf("failed to create cleanup task: %w", err)
+	}
+	return nil
+}
+
+func (s *Service) BanUser(userAddr, reason string) error {
+	return s.db.SetBan(db.Ban{
+		Address:   userAddr,
+		Reason:    reason,
+		CreatedAt: time.Now(),
+	})
+}
+
+func (s *Service) UnbanUser(userAddr string) error {
+	return s.db.DeleteBan(userAddr)
+}
+
+func (s *Service) ListBans() ([]AdminBan, error) {
+	bans, err := s.db.GetBans()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve bans: %w", err)
+	}
+
+	list := make([]AdminBan, 0, len(bans))
+	for _, ban := range bans {
+		list = append(list, AdminBan{
+			Address:   ban.Address,
+			Reason:    ban.Reason,
+			CreatedAt: ban.CreatedAt,
+		})
+	}
+	return list, nil
+}
+
+// GetDiskUsage returns size of the storage directory and free space of its filesystem
+func (s *Service) GetDiskUsage() *DiskUsage {
+	usage := &DiskUsage{
+		StorageDir:  s.storageBaseDir,
+		UsedBytes:   diskSize(s.storageBaseDir),
+		UploadBytes: diskSize(s.uploadsDir()),
+	}
+	usage.FreeBytes, usage.TotalBytes = fsSpace(s.storageBaseDir)
+	return usage
+}
+
+// keyOwner returns owner address of the file key
+func keyOwner(key string) string {
+	owner, _, _ := strings.Cut(key, ":")
+	return owner
+}
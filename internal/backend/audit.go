@@ -0,0 +1,118 @@
+package backend
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/xssnick/ton-provider-web/internal/backend/db"
+	"net/http"
+	"time"
+)
+
+const (
+	AuditLogin          = "login"
+	AuditLogoutAll      = "logout_all"
+	AuditUpload         = "upload"
+	AuditImport         = "import"
+	AuditImportFailed   = "import_failed"
+	AuditRemove         = "remove"
+	AuditDeployData     = "deploy_data"
+	AuditWithdrawData   = "withdraw_data"
+	AuditTopupData      = "topup_data"
+	AuditTokenCreate    = "token_create"
+	AuditTokenRevoke    = "token_revoke"
+	AuditNotifySettings = "notify_settings"
+	AuditTelegramLink   = "telegram_link"
+	AuditTelegramUnlink = "telegram_unlink"
+	AuditWebhookCreate  = "webhook_create"
+	AuditWebhookRemove  = "webhook_remove"
+
+	AuditAdminRemove  = "admin_remove"
+	AuditAdminRequeue = "admin_requeue"
+	AuditAdminBan     = "admin_ban"
+	AuditAdminUnban   = "admin_unban"
+	AuditAdminPlan    = "admin_plan"
+	// provider actions do not relate to a user, so they are recorded for the admin who did them
+	AuditAdminProviderAdd     = "admin_provider_add"
+	AuditAdminProviderDisable = "admin_provider_disable"
+)
+
+const (
+	auditRetention    = 90 * 24 * time.Hour
+	auditDefaultLimit = 100
+	maxAuditLimit     = 1000
+)
+
+type AuditEntry struct {
+	ID        string            `json:"id"`
+	Action    string            `json:"action"`
+	Actor     string            `json:"actor"`
+	Details   map[string]string `json:"details,omitempty"`
+	IP        string            `json:"ip"`
+	RequestID string            `json:"request_id"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// Audit records action related to the user, actor, ip and request id are taken from the request context.
+// Failure is only logged, action is already done at this point and should not be reported as failed
+func (s *Service) Audit(ctx context.Context, userAddr, action string, details map[string]string) {
+	info := getRequestInfo(ctx)
+
+	actor := info.Addr
+	if actor == "" {
+		actor = info.Auth
+	}
+
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+
+	entry := db.AuditEntry{
+		ID:        hex.EncodeToString(id),
+		UserAddr:  userAddr,
+		Actor:     actor,
+		Action:    action,
+		Details:   details,
+		IP:        info.IP,
+		RequestID: info.ID,
+		CreatedAt: time.Now(),
+	}
+
+	if err := s.db.AddAuditEntry(entry, auditRetention); err != nil {
+		ctxLogger(ctx, &s.logger).Error().Err(err).Str("addr", userAddr).Str("action", action).Msg("failed to store audit entry")
+	}
+}
+
+// ListAuditEntries returns user's audit log from newest to oldest, before is the time of the last entry of the previous page
+func (s *Service) ListAuditEntries(userAddr string, before time.Time, limit int) ([]AuditEntry, error) {
+	if limit <= 0 {
+		limit = auditDefaultLimit
+	}
+	if limit > maxAuditLimit {
+		limit = maxAuditLimit
+	}
+
+	entries, err := s.db.GetAuditEntries(userAddr, before, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve audit log: %w", err)
+	}
+
+	list := make([]AuditEntry, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, AuditEntry{
+			ID:        e.ID,
+			Action:    e.Action,
+			Actor:     e.Actor,
+			Details:   e.Details,
+			IP:        e.IP,
+			RequestID: e.RequestID,
+			CreatedAt: e.CreatedAt,
+		})
+	}
+	return list, nil
+}
+
+// audit records action of the request, for the user it relates to
+func (s *Server) audit(r *http.Request, userAddr, action string, details map[string]string) {
+	s.svc.Audit(r.Context(), userAddr, action, details)
+}
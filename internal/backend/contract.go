@@ -9,8 +9,11 @@ import (
 	"github.com/xssnick/tonutils-go/tlb"
 	"github.com/xssnick/tonutils-go/tvm/cell"
 	"github.com/xssnick/tonutils-storage-provider/pkg/contract"
+	"github.com/xssnick/tonutils-storage-provider/pkg/transport"
 	"github.com/xssnick/tonutils-storage/provider"
 	"math/big"
+	"sort"
+	"sync"
 	"time"
 )
 
@@ -18,29 +21,33 @@ func (s *Service) getContractWithdrawData(bag *db.Bag, owner *address.Address) (
 	return contract.PrepareWithdrawalRequest(bag.RootHash, bag.MerkleHash, bag.FullSize, bag.PieceSize, owner)
 }
 
-func (s *Service) getContractDeployData(ctx context.Context, bag *db.Bag, owner *address.Address, providerKey []byte) (*provider.Offer, *address.Address, *cell.Cell, *cell.Cell, error) {
-	sr, err := s.provider.GetStorageRates(ctx, providerKey, bag.FullSize)
+// providerOffer is the best offer of the provider for the bag
+type providerOffer struct {
+	Key   []byte
+	Offer provider.Offer
+}
+
+// getContractDeployData prepares contract with the given number of the cheapest available providers from the registry
+func (s *Service) getContractDeployData(ctx context.Context, bag *db.Bag, owner *address.Address, replicas int) ([]providerOffer, *address.Address, *cell.Cell, *cell.Cell, error) {
+	offers, err := s.getProviderOffers(ctx, bag.FullSize)
 	if err != nil {
-		return nil, nil, nil, nil, fmt.Errorf("failed to get storage rates: %w", err)
+		return nil, nil, nil, nil, err
+	}
+	if len(offers) < replicas {
+		return nil, nil, nil, nil, fmt.Errorf("%w: %d of %d are available", ErrNotEnoughProviders, len(offers), replicas)
 	}
+	offers = offers[:replicas]
 
-	off := provider.CalculateBestProviderOffer(&provider.ProviderRates{
-		Available:        sr.Available,
-		RatePerMBDay:     tlb.FromNanoTON(new(big.Int).SetBytes(sr.RatePerMBDay)),
-		MinBounty:        tlb.FromNanoTON(new(big.Int).SetBytes(sr.MinBounty)),
-		SpaceAvailableMB: sr.SpaceAvailableMB,
-		MinSpan:          sr.MinSpan,
-		MaxSpan:          sr.MaxSpan,
-		Size:             bag.FullSize,
-	})
+	providers := make([]contract.ProviderV1, 0, len(offers))
+	for _, o := range offers {
+		providers = append(providers, contract.ProviderV1{
+			Address:       address.NewAddress(0, 0, o.Key),
+			MaxSpan:       o.Offer.Span,
+			PricePerMBDay: tlb.FromNanoTON(o.Offer.RatePerMBNano),
+		})
+	}
 
-	addr, si, body, err := contract.PrepareV1DeployData(bag.RootHash, bag.MerkleHash, bag.FullSize, bag.PieceSize, owner, []contract.ProviderV1{
-		{
-			Address:       address.NewAddress(0, 0, providerKey),
-			MaxSpan:       off.Span,
-			PricePerMBDay: tlb.FromNanoTON(off.RatePerMBNano),
-		},
-	})
+	addr, si, body, err := contract.PrepareV1DeployData(bag.RootHash, bag.MerkleHash, bag.FullSize, bag.PieceSize, owner, providers)
 	if err != nil {
 		return nil, nil, nil, nil, fmt.Errorf("failed to prepare deploy data: %w", err)
 	}
@@ -50,7 +57,61 @@ func (s *Service) getContractDeployData(ctx context.Context, bag *db.Bag, owner
 		return nil, nil, nil, nil, fmt.Errorf("failed to convert si to cell: %w", err)
 	}
 
-	return &off, addr, siCell, body, nil
+	return offers, addr, siCell, body, nil
+}
+
+// getProviderOffers requests actual rates of providers in parallel, and returns offers of available ones, cheapest first
+func (s *Service) getProviderOffers(ctx context.Context, size uint64) ([]providerOffer, error) {
+	keys, err := s.offerProviderKeys()
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*providerOffer, len(keys))
+
+	var wg sync.WaitGroup
+	for i, key := range keys {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			sr, err := s.provider.GetStorageRates(ctx, key, size)
+			if err != nil {
+				chainFailures.WithLabelValues("get_storage_rates").Inc()
+				ctxLogger(ctx, &s.logger).Debug().Err(err).Hex("provider", key).Msg("failed to get storage rates")
+				return
+			}
+			if !sr.Available {
+				return
+			}
+
+			results[i] = &providerOffer{Key: key, Offer: calculateOffer(sr, size)}
+		}()
+	}
+	wg.Wait()
+
+	var offers []providerOffer
+	for _, o := range results {
+		if o != nil {
+			offers = append(offers, *o)
+		}
+	}
+
+	sort.SliceStable(offers, func(i, j int) bool {
+		return offers[i].Offer.PerDayNano.Cmp(offers[j].Offer.PerDayNano) < 0
+	})
+	return offers, nil
+}
+
+func calculateOffer(sr *transport.StorageRatesResponse, size uint64) provider.Offer {
+	return provider.CalculateBestProviderOffer(&provider.ProviderRates{
+		Available:        sr.Available,
+		RatePerMBDay:     tlb.FromNanoTON(new(big.Int).SetBytes(sr.RatePerMBDay)),
+		MinBounty:        tlb.FromNanoTON(new(big.Int).SetBytes(sr.MinBounty)),
+		SpaceAvailableMB: sr.SpaceAvailableMB,
+		MinSpan:          sr.MinSpan,
+		MaxSpan:          sr.MaxSpan,
+		Size:             size,
+	})
 }
 
 func (s *Service) calcContractAddr(bag *db.Bag, owner *address.Address) (*address.Address, error) {
@@ -61,44 +122,98 @@ func (s *Service) calcContractAddr(bag *db.Bag, owner *address.Address) (*addres
 	return addr, nil
 }
 
-func (s *Service) fetchContractInfo(ctx context.Context, bag *db.Bag, owner *address.Address, providerKey []byte) (tlb.Coins, uint64, tlb.Coins, string, error) {
+// contractProvider is the state of one of our providers in the storage contract
+type contractProvider struct {
+	Key         []byte
+	ByteToProof uint64
+	PerDay      tlb.Coins
+	// Share is a part of contract balance proportional to provider's price, balance is common for all providers
+	Share     tlb.Coins
+	Left      string
+	PaidUntil time.Time
+
+	RatePerMB   *big.Int
+	MaxSpan     uint32
+	LastProofAt time.Time
+}
+
+// fetchContractInfo returns contract balance and states of the configured providers which are in the contract
+func (s *Service) fetchContractInfo(ctx context.Context, bag *db.Bag, owner *address.Address) (tlb.Coins, []contractProvider, error) {
 	addr, _, _, err := contract.PrepareV1DeployData(bag.RootHash, bag.MerkleHash, bag.FullSize, bag.PieceSize, owner, nil)
 	if err != nil {
-		return tlb.ZeroCoins, 0, tlb.ZeroCoins, "", fmt.Errorf("failed to calc contract addr: %w", err)
+		return tlb.ZeroCoins, nil, fmt.Errorf("failed to calc contract addr: %w", err)
 	}
 
 	master, err := s.api.CurrentMasterchainInfo(ctx)
 	if err != nil {
-		return tlb.ZeroCoins, 0, tlb.ZeroCoins, "", fmt.Errorf("failed to fetch master block: %w", err)
+		return tlb.ZeroCoins, nil, fmt.Errorf("failed to fetch master block: %w", err)
 	}
 
-	data, balance, err := contract.GetProviderDataV1(ctx, s.api, master, addr, providerKey)
+	list, balance, err := contract.GetProvidersV1(ctx, s.api, master, addr)
 	if err != nil {
 		if errors.Is(err, contract.ErrNotDeployed) {
-			return tlb.ZeroCoins, 0, tlb.ZeroCoins, "", contract.ErrNotDeployed
+			return tlb.ZeroCoins, nil, contract.ErrNotDeployed
 		}
-		return tlb.ZeroCoins, 0, tlb.ZeroCoins, "", fmt.Errorf("failed to fetch providers list: %w", err)
+		return tlb.ZeroCoins, nil, fmt.Errorf("failed to fetch providers list: %w", err)
 	}
 
-	szMB := new(big.Float).Quo(
-		new(big.Float).SetUint64(bag.FullSize),
-		big.NewFloat(1024*1024),
-	)
+	keys, err := s.providerKeys()
+	if err != nil {
+		return tlb.ZeroCoins, nil, err
+	}
+
+	var ours []contract.ProviderDataV1
+	for _, p := range list {
+		if containsKey(keys, p.Key) {
+			ours = append(ours, p)
+		}
+	}
+	if len(ours) == 0 {
+		return tlb.ZeroCoins, nil, contract.ErrProviderNotFound
+	}
 
-	pricePerDay, _ := new(big.Float).Mul(szMB, new(big.Float).SetInt(data.RatePerMB.Nano())).Int(nil)
+	szMB := bagSizeMB(bag.FullSize)
 
-	days := daysLeft(balance.Nano(), data.RatePerMB.Nano(), szMB, data.MaxSpan, data.LastProofAt)
+	perDay := make([]*big.Int, len(ours))
+	for i, p := range ours {
+		perDay[i] = pricePerDay(p.RatePerMB.Nano(), szMB)
+	}
+	shares := shareBalance(balance.Nano(), perDay)
 
-	return balance, data.ByteToProof, tlb.FromNanoTON(pricePerDay), days, nil
+	providers := make([]contractProvider, 0, len(ours))
+	for i, p := range ours {
+		days, paidUntil := daysLeft(shares[i], p.RatePerMB.Nano(), szMB, p.MaxSpan, p.LastProofAt)
+
+		providers = append(providers, contractProvider{
+			Key:         p.Key,
+			ByteToProof: p.ByteToProof,
+			PerDay:      tlb.FromNanoTON(perDay[i]),
+			Share:       tlb.FromNanoTON(shares[i]),
+			Left:        days,
+			PaidUntil:   paidUntil,
+			RatePerMB:   p.RatePerMB.Nano(),
+			MaxSpan:     p.MaxSpan,
+			LastProofAt: p.LastProofAt,
+		})
+	}
+
+	return balance, providers, nil
 }
 
-func daysLeft(
-	balance *big.Int,
-	ratePerMBDay *big.Int,
-	szMB *big.Float,
-	maxSpan uint32,
-	lastProofAt time.Time,
-) string {
+func bagSizeMB(size uint64) *big.Float {
+	return new(big.Float).Quo(
+		new(big.Float).SetUint64(size),
+		big.NewFloat(1024*1024),
+	)
+}
+
+func pricePerDay(ratePerMBDay *big.Int, szMB *big.Float) *big.Int {
+	price, _ := new(big.Float).Mul(szMB, new(big.Float).SetInt(ratePerMBDay)).Int(nil)
+	return price
+}
+
+// pricePerSpan is what provider gets for each proof
+func pricePerSpan(ratePerMBDay *big.Int, szMB *big.Float, maxSpan uint32) *big.Int {
 	spanDays := new(big.Float).Quo(
 		new(big.Float).SetUint64(uint64(maxSpan)),
 		new(big.Float).SetFloat64(86400),
@@ -107,12 +222,41 @@ func daysLeft(
 	pricePerSpanFloat := new(big.Float).Mul(szMB, new(big.Float).SetInt(ratePerMBDay))
 	pricePerSpanFloat.Mul(pricePerSpanFloat, spanDays)
 
-	pricePerSpan, _ := pricePerSpanFloat.Int(nil)
-	if pricePerSpan.Sign() == 0 {
-		return "Expired"
+	price, _ := pricePerSpanFloat.Int(nil)
+	return price
+}
+
+// shareBalance splits common contract balance between providers proportionally to their price per day
+func shareBalance(balance *big.Int, perDay []*big.Int) []*big.Int {
+	total := new(big.Int)
+	for _, p := range perDay {
+		total.Add(total, p)
+	}
+
+	shares := make([]*big.Int, len(perDay))
+	for i, p := range perDay {
+		shares[i] = new(big.Int)
+		if total.Sign() > 0 {
+			shares[i].Mul(balance, p)
+			shares[i].Div(shares[i], total)
+		}
+	}
+	return shares
+}
+
+func daysLeft(
+	balance *big.Int,
+	ratePerMBDay *big.Int,
+	szMB *big.Float,
+	maxSpan uint32,
+	lastProofAt time.Time,
+) (string, time.Time) {
+	perSpan := pricePerSpan(ratePerMBDay, szMB, maxSpan)
+	if perSpan.Sign() == 0 {
+		return "Expired", time.Now()
 	}
 
-	spansLeft := new(big.Int).Div(balance, pricePerSpan).Int64()
+	spansLeft := new(big.Int).Div(balance, perSpan).Int64()
 
 	ago := uint32(time.Since(lastProofAt).Seconds())
 	leftInCurrentSpan := int64(0)
@@ -125,5 +269,5 @@ func daysLeft(
 	days := totalSecondsLeft / 86400
 	hours := (totalSecondsLeft % 86400) / 3600
 
-	return fmt.Sprintf("%d Days %d Hours", days, hours)
+	return fmt.Sprintf("%d Days %d Hours", days, hours), time.Now().Add(time.Duration(totalSecondsLeft) * time.Second)
 }
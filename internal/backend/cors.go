@@ -0,0 +1,71 @@
+package backend
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	corsAllowMethods  = "GET, HEAD, POST, DELETE"
+	corsAllowHeaders  = "Authorization, Content-Type, X-Share-Password, X-Admin-Key, X-Request-ID"
+	corsExposeHeaders = "Upload-Offset, X-Next-Cursor, X-Request-ID"
+)
+
+// allowedOrigins matches full origins like https://example.com:8443, or any origin of the listed hostnames
+type allowedOrigins struct {
+	origins   map[string]bool
+	hostnames map[string]bool
+}
+
+func newAllowedOrigins(list []string) *allowedOrigins {
+	a := &allowedOrigins{
+		origins:   map[string]bool{},
+		hostnames: map[string]bool{},
+	}
+
+	for _, o := range list {
+		o = strings.ToLower(strings.TrimRight(strings.TrimSpace(o), "/"))
+		if strings.Contains(o, "://") {
+			a.origins[o] = true
+		} else if o != "" {
+			a.hostnames[o] = true
+		}
+	}
+	return a
+}
+
+func (a *allowedOrigins) allowed(origin string) bool {
+	origin = strings.ToLower(origin)
+	if a.origins[origin] {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	return a.hostnames[u.Hostname()]
+}
+
+// setCORSHeaders allows browser to read response from the already verified origin, cookies included
+func setCORSHeaders(w http.ResponseWriter, origin string) {
+	h := w.Header()
+	h.Set("Access-Control-Allow-Origin", origin)
+	h.Set("Access-Control-Allow-Credentials", "true")
+	h.Set("Access-Control-Expose-Headers", corsExposeHeaders)
+	h.Add("Vary", "Origin")
+}
+
+// isPreflight checks if request is CORS preflight, it has no credentials and should be answered before auth
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+func writePreflight(w http.ResponseWriter) {
+	h := w.Header()
+	h.Set("Access-Control-Allow-Methods", corsAllowMethods)
+	h.Set("Access-Control-Allow-Headers", corsAllowHeaders)
+	h.Set("Access-Control-Max-Age", "600")
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,242 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrNotFound = errors.New("not found")
+
+type Ban struct {
+	Address   string
+	Reason    string
+	CreatedAt time.Time
+}
+
+// GetAllFiles retrieves files of all users, iteration starts after the given key when it is not empty
+func (d *Database) GetAllFiles(after string, limit int) ([]FileInfo, error) {
+	var list []FileInfo
+
+	rng := util.BytesPrefix([]byte("file:"))
+	if after != "" {
+		rng.Start = []byte("file:" + after + "\x00")
+	}
+
+	iter := d.db.NewIterator(rng, nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		var fileData FileInfo
+		if err := json.Unmarshal(iter.Value(), &fileData); err != nil {
+			d.logger.Error().Err(err).Str("key", string(iter.Key())).Msg("failed to unmarshal file data")
+			continue
+		}
+		fileData.Key = string(iter.Key())[len("file:"):]
+
+		list = append(list, fileData)
+		if limit > 0 && len(list) >= limit {
+			break
+		}
+	}
+
+	if err := iter.Error(); err != nil {
+		d.logger.Error().Err(err).Msg("iterator error while retrieving all files")
+		return nil, err
+	}
+	return list, nil
+}
+
+// GetUsersWithFiles returns addresses of users who have files, ordered, after is the last address of the previous page.
+// Files are keyed by user, so iterator jumps over files of every user instead of reading them
+func (d *Database) GetUsersWithFiles(after string, limit int) ([]string, error) {
+	iter := d.db.NewIterator(util.BytesPrefix([]byte("file:")), nil)
+	defer iter.Release()
+
+	start := "file:"
+	if after != "" {
+		// ';' follows ':', so it is the first key after all files of the user
+		start = "file:" + after + ";"
+	}
+
+	var list []string
+	for ok := iter.Seek([]byte(start)); ok && (limit <= 0 || len(list) < limit); {
+		owner, _, _ := strings.Cut(string(iter.Key())[len("file:"):], ":")
+		list = append(list, owner)
+		ok = iter.Seek([]byte("file:" + owner + ";"))
+	}
+
+	if err := iter.Error(); err != nil {
+		d.logger.Error().Err(err).Msg("iterator error while retrieving users")
+		return nil, err
+	}
+	return list, nil
+}
+
+// GetAllCleanupTasks retrieves all cleanup tasks, including not yet ready for execution
+func (d *Database) GetAllCleanupTasks() ([]CleanupTask, error) {
+	var tasks []CleanupTask
+
+	prefix := "clean-task:"
+	iter := d.db.NewIterator(util.BytesPrefix([]byte(prefix)), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		var task CleanupTask
+		if err := json.Unmarshal(iter.Value(), &task); err != nil {
+			d.logger.Error().Err(err).Str("key", string(iter.Key())).Msg("failed to unmarshal cleanup task")
+			continue
+		}
+		task.Key = string(iter.Key())[len(prefix):]
+		tasks = append(tasks, task)
+	}
+
+	if err := iter.Error(); err != nil {
+		d.logger.Error().Err(err).Msg("iterator error while retrieving cleanup tasks")
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// GetAllUpdateTasks retrieves all update tasks, including not yet ready for execution
+func (d *Database) GetAllUpdateTasks() ([]UpdateTask, error) {
+	var tasks []UpdateTask
+
+	iter := d.db.NewIterator(util.BytesPrefix([]byte("update-task:")), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		keyParts := strings.SplitN(string(iter.Key()), ":", 3)
+		if len(keyParts) != 3 {
+			continue
+		}
+
+		execAt, err := strconv.ParseInt(keyParts[1], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		tasks = append(tasks, UpdateTask{
+			Key:    keyParts[2],
+			ExecAt: time.Unix(execAt, 0),
+		})
+	}
+
+	if err := iter.Error(); err != nil {
+		d.logger.Error().Err(err).Msg("iterator error while retrieving update tasks")
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// RequeueStoreTask creates store task for existing file
+func (d *Database) RequeueStoreTask(key string) error {
+	exists, err := d.db.Has([]byte("file:"+key), nil)
+	if err != nil {
+		return fmt.Errorf("failed to check file: %w", err)
+	}
+	if !exists {
+		return ErrNotFound
+	}
+
+	if err = d.db.Put([]byte("store-task:"+key), []byte{}, &opt.WriteOptions{Sync: false}); err != nil {
+		return fmt.Errorf("failed to store task: %w", err)
+	}
+	return nil
+}
+
+// RequeueCleanupTask makes existing cleanup task ready for execution now
+func (d *Database) RequeueCleanupTask(key string) error {
+	data, err := d.db.Get([]byte("clean-task:"+key), nil)
+	if err != nil {
+		if errors.Is(err, leveldb.ErrNotFound) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to get cleanup task: %w", err)
+	}
+
+	var task CleanupTask
+	if err = json.Unmarshal(data, &task); err != nil {
+		return fmt.Errorf("failed to unmarshal cleanup task: %w", err)
+	}
+	task.ExecAt = time.Now()
+
+	if data, err = json.Marshal(task); err != nil {
+		return fmt.Errorf("failed to marshal cleanup task: %w", err)
+	}
+
+	if err = d.db.Put([]byte("clean-task:"+key), data, &opt.WriteOptions{Sync: false}); err != nil {
+		return fmt.Errorf("failed to store cleanup task: %w", err)
+	}
+	return nil
+}
+
+// RequeueUpdateTask creates immediate not repeating update task for existing file
+func (d *Database) RequeueUpdateTask(key string) error {
+	exists, err := d.db.Has([]byte("file:"+key), nil)
+	if err != nil {
+		return fmt.Errorf("failed to check file: %w", err)
+	}
+	if !exists {
+		return ErrNotFound
+	}
+
+	if err = d.db.Put([]byte(fmt.Sprintf("update-task:%d:%s", 0, key)), []byte{}, &opt.WriteOptions{Sync: false}); err != nil {
+		return fmt.Errorf("failed to store task: %w", err)
+	}
+	return nil
+}
+
+func (d *Database) SetBan(ban Ban) error {
+	data, err := json.Marshal(ban)
+	if err != nil {
+		return fmt.Errorf("failed to marshal ban: %w", err)
+	}
+
+	if err = d.db.Put([]byte("ban:"+ban.Address), data, &opt.WriteOptions{Sync: true}); err != nil {
+		return fmt.Errorf("failed to store ban: %w", err)
+	}
+	return nil
+}
+
+func (d *Database) DeleteBan(userID string) error {
+	if err := d.db.Delete([]byte("ban:"+userID), &opt.WriteOptions{Sync: true}); err != nil {
+		return fmt.Errorf("failed to delete ban: %w", err)
+	}
+	return nil
+}
+
+func (d *Database) IsBanned(userID string) (bool, error) {
+	exists, err := d.db.Has([]byte("ban:"+userID), nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to check ban: %w", err)
+	}
+	return exists, nil
+}
+
+func (d *Database) GetBans() ([]Ban, error) {
+	var list []Ban
+
+	iter := d.db.NewIterator(util.BytesPrefix([]byte("ban:")), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		var ban Ban
+		if err := json.Unmarshal(iter.Value(), &ban); err != nil {
+			continue
+		}
+		list = append(list, ban)
+	}
+
+	if err := iter.Error(); err != nil {
+		d.logger.Error().Err(err).Msg("iterator error while retrieving bans")
+		return nil, err
+	}
+	return list, nil
+}
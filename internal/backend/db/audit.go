@@ -0,0 +1,94 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"time"
+)
+
+// AuditEntry is a record of security-relevant action, stored under the user it relates to
+type AuditEntry struct {
+	ID        string
+	UserAddr  string
+	Actor     string
+	Action    string
+	Details   map[string]string
+	IP        string
+	RequestID string
+	CreatedAt time.Time
+}
+
+// AddAuditEntry stores entry, entries of the same user older than retention are removed in the same batch
+func (d *Database) AddAuditEntry(entry AuditEntry, retention time.Duration) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry: %w", err)
+	}
+
+	batch := new(leveldb.Batch)
+
+	// keys are ordered by time, so expired entries are at the beginning
+	prefix := "audit:" + entry.UserAddr + ":"
+	iter := d.db.NewIterator(&util.Range{
+		Start: []byte(prefix),
+		Limit: []byte(auditKey(entry.UserAddr, entry.CreatedAt.Add(-retention), "")),
+	}, nil)
+	for iter.Next() {
+		batch.Delete(append([]byte{}, iter.Key()...))
+	}
+	iter.Release()
+	if err = iter.Error(); err != nil {
+		d.logger.Error().Err(err).Str("addr", entry.UserAddr).Msg("iterator error while cleaning audit log")
+		return fmt.Errorf("failed to iterate audit log: %w", err)
+	}
+
+	batch.Put([]byte(auditKey(entry.UserAddr, entry.CreatedAt, entry.ID)), data)
+	if err = d.db.Write(batch, &opt.WriteOptions{Sync: false}); err != nil {
+		d.logger.Error().Err(err).Str("addr", entry.UserAddr).Msg("failed to store audit entry")
+		return fmt.Errorf("failed to store audit entry: %w", err)
+	}
+	return nil
+}
+
+// GetAuditEntries returns entries of the user from newest to oldest, created before the given time when it is not zero
+func (d *Database) GetAuditEntries(userAddr string, before time.Time, limit int) ([]AuditEntry, error) {
+	rng := util.BytesPrefix([]byte("audit:" + userAddr + ":"))
+	if !before.IsZero() {
+		rng.Limit = []byte(auditKey(userAddr, before, ""))
+	}
+
+	iter := d.db.NewIterator(rng, nil)
+	defer iter.Release()
+
+	var list []AuditEntry
+	for ok := iter.Last(); ok && len(list) < limit; ok = iter.Prev() {
+		entry, err := unmarshalAuditEntry(iter)
+		if err != nil {
+			d.logger.Error().Err(err).Str("key", string(iter.Key())).Msg("failed to unmarshal audit entry")
+			continue
+		}
+		list = append(list, *entry)
+	}
+
+	if err := iter.Error(); err != nil {
+		d.logger.Error().Err(err).Str("addr", userAddr).Msg("iterator error while retrieving audit log")
+		return nil, err
+	}
+	return list, nil
+}
+
+func unmarshalAuditEntry(iter iterator.Iterator) (*AuditEntry, error) {
+	var entry AuditEntry
+	if err := json.Unmarshal(iter.Value(), &entry); err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func auditKey(user string, at time.Time, id string) string {
+	return fmt.Sprintf("audit:%s:%020d:%s", user, at.UnixNano(), id)
+}
@@ -29,9 +29,17 @@ type FileInfo struct {
 	OwnerAddr string
 	Bag       *Bag
 	FilePath  string
+	Dir       bool
 	CreatedAt time.Time
 	Provider  *ProviderInfo
 
+	// ImportBagID is set when file is an existing bag added by id, its data is managed by storage daemon
+	ImportBagID []byte `json:",omitempty"`
+	// Size is size of the received data, it is counted in usage until bag is created
+	Size uint64 `json:",omitempty"`
+	// RequestID is id of the request which added the file, to follow it in logs of background tasks
+	RequestID string `json:",omitempty"`
+
 	ContractAddr string
 }
 
@@ -41,6 +49,12 @@ type Bag struct {
 	FullSize   uint64
 	PieceSize  uint32
 	CreatedAt  time.Time
+	Files      []BagFile
+}
+
+type BagFile struct {
+	Name string
+	Size uint64
 }
 
 type ProviderInfo struct {
@@ -49,8 +63,27 @@ type ProviderInfo struct {
 	Status      string
 	Reason      string
 	Left        string
+	PaidUntil   time.Time
 	LastUpdated time.Time
 	ErrorSince  *time.Time
+	// AlertedDays is the lowest expiry threshold user was alerted about, it is reset when contract is topped up
+	AlertedDays uint32 `json:",omitempty"`
+
+	// Providers are states of each provider of the contract, fields above are aggregated from them
+	Providers []ProviderState `json:",omitempty"`
+}
+
+type ProviderState struct {
+	Key     []byte
+	Status  string
+	Reason  string
+	Balance string
+	PerDay  string
+	Left    string
+	// Error is set when provider was not reachable on the last update, status is kept from the previous one
+	Error      string `json:",omitempty"`
+	PaidUntil  time.Time
+	ErrorSince *time.Time
 }
 
 type BagInfo struct {
@@ -163,25 +196,33 @@ func (d *Database) StoreFileInfo(userID string, fileData FileInfo) error {
 	d.mx.Lock() // not allow concurrency to bypass Has verification
 	defer d.mx.Unlock()
 
+	batch := new(leveldb.Batch)
+	if err = d.putNewFile(batch, userID, fileData.FilePath, jsonData); err != nil {
+		return err
+	}
+	if err := d.db.Write(batch, &opt.WriteOptions{Sync: false}); err != nil {
+		d.logger.Error().Err(err).Str("id", userID).Msg("failed to store file data and task key")
+		return fmt.Errorf("failed to store file data and task key: %w", err)
+	}
+	return nil
+}
+
+// putNewFile adds file data and its store task to batch, mx must be locked by caller
+func (d *Database) putNewFile(batch *leveldb.Batch, userID, filePath string, jsonData []byte) error {
 	// Check if the file data for the userID and FilePath already exists in the database
-	key := "file:" + userID + ":" + fileData.FilePath
+	key := "file:" + userID + ":" + filePath
 	exists, err := d.db.Has([]byte(key), nil)
 	if err != nil {
-		d.logger.Error().Err(err).Str("id", userID).Str("filePath", fileData.FilePath).Msg("failed to check existing file data")
+		d.logger.Error().Err(err).Str("id", userID).Str("filePath", filePath).Msg("failed to check existing file data")
 		return fmt.Errorf("failed to check existing file data: %w", err)
 	}
 
 	if exists {
-		return fmt.Errorf("file data already exists for user %s with filePath %s, remove it first before upload new", userID, fileData.FilePath)
+		return fmt.Errorf("file data already exists for user %s with filePath %s, remove it first before upload new", userID, filePath)
 	}
 
-	batch := new(leveldb.Batch)
 	batch.Put([]byte(key), jsonData)
-	batch.Put([]byte("store-task:"+userID+":"+fileData.FilePath), []byte{})
-	if err := d.db.Write(batch, &opt.WriteOptions{Sync: false}); err != nil {
-		d.logger.Error().Err(err).Str("id", userID).Msg("failed to store file data and task key")
-		return fmt.Errorf("failed to store file data and task key: %w", err)
-	}
+	batch.Put([]byte("store-task:"+userID+":"+filePath), []byte{})
 	return nil
 }
 
@@ -204,6 +245,10 @@ func (d *Database) CompleteStoreTask(key string, bag Bag, contractAddr string, c
 		fileData.State = FileStateBag
 		fileData.Bag = &bag
 		fileData.ContractAddr = contractAddr
+		if fileData.ImportBagID != nil {
+			// structure of imported bag is known only now, files inside it are addressed like in uploaded folder
+			fileData.Dir = len(bag.Files) > 1
+		}
 
 		// Check if the bag ID already exists in the database
 		existingBagKey := "bag:" + hex.EncodeToString(bag.RootHash)
@@ -388,6 +433,8 @@ func (d *Database) CompleteCleanTask(key string, remove bool) (bool, error) {
 				}
 			}
 			batch.Delete([]byte("file:" + key))
+			// file can be removed before bag is created, so its store task is not needed anymore
+			batch.Delete([]byte("store-task:" + key))
 		}
 	}
 
@@ -525,6 +572,15 @@ func (d *Database) GetFile(key, name string) (*FileInfo, error) {
 	return d.GetFileByKey(fileKey(key, name))
 }
 
+// HasBag checks whether bag is used by any file which has completed store task
+func (d *Database) HasBag(rootHash []byte) (bool, error) {
+	exists, err := d.db.Has([]byte("bag:"+hex.EncodeToString(rootHash)), nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to check bag: %w", err)
+	}
+	return exists, nil
+}
+
 // GetFileByKey retrieves a FileInfo object based on the provided key
 func (d *Database) GetFileByKey(key string) (*FileInfo, error) {
 	data, err := d.db.Get([]byte("file:"+key), nil)
@@ -549,7 +605,19 @@ func (d *Database) GetFileByKey(key string) (*FileInfo, error) {
 // GetFilesByUser retrieves the list of FileInfo objects for a given user ID
 func (d *Database) GetFilesByUser(userID string) ([]FileInfo, error) {
 	var fileDataList []FileInfo
+	err := d.IterateFilesByUser(userID, func(fileData *FileInfo) bool {
+		fileDataList = append(fileDataList, *fileData)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fileDataList, nil
+}
 
+// IterateFilesByUser calls fn for every file of the user in name order without loading all of them,
+// iteration stops when fn returns false
+func (d *Database) IterateFilesByUser(userID string, fn func(fileData *FileInfo) bool) error {
 	// Use a prefix-based range to optimize iteration
 	prefix := "file:" + userID + ":"
 	iter := d.db.NewIterator(util.BytesPrefix([]byte(prefix)), nil)
@@ -561,14 +629,57 @@ func (d *Database) GetFilesByUser(userID string) ([]FileInfo, error) {
 			d.logger.Error().Err(err).Str("id", userID).Msg("failed to unmarshal file data")
 			continue
 		}
-		fileDataList = append(fileDataList, fileData)
+		if !fn(&fileData) {
+			break
+		}
 	}
 
 	if err := iter.Error(); err != nil {
 		d.logger.Error().Err(err).Str("userID", userID).Msg("Iterator error")
+		return err
+	}
+	return nil
+}
+
+type FilesStats struct {
+	ByState map[int]uint64
+	Bytes   uint64
+}
+
+// GetFilesStats counts files of all users by state and sums sizes of their bags
+func (d *Database) GetFilesStats() (*FilesStats, error) {
+	stats := &FilesStats{
+		ByState: map[int]uint64{},
+	}
+
+	iter := d.db.NewIterator(util.BytesPrefix([]byte("file:")), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		var fileData FileInfo
+		if err := json.Unmarshal(iter.Value(), &fileData); err != nil {
+			continue
+		}
+
+		stats.ByState[fileData.State]++
+		if fileData.Bag != nil {
+			stats.Bytes += fileData.Bag.FullSize
+		}
+	}
+
+	if err := iter.Error(); err != nil {
+		d.logger.Error().Err(err).Msg("iterator error while counting files")
 		return nil, err
 	}
-	return fileDataList, nil
+	return stats, nil
+}
+
+// Ping checks that database is readable
+func (d *Database) Ping() error {
+	if _, err := d.db.Has([]byte("chain-lt"), nil); err != nil {
+		return fmt.Errorf("failed to read database: %w", err)
+	}
+	return nil
 }
 
 // Close closes the LevelDB database
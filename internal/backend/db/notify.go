@@ -0,0 +1,333 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"strings"
+	"time"
+)
+
+const (
+	NotificationPending   = "pending"
+	NotificationDelivered = "delivered"
+	NotificationFailed    = "failed"
+)
+
+// NotifySettings are user's channels for expiry alerts, alert is sent when time left of a file
+// becomes less than one of the thresholds
+type NotifySettings struct {
+	ThresholdDays  []uint32
+	WebhookURL     string `json:",omitempty"`
+	WebhookSecret  string `json:",omitempty"`
+	TelegramChatID int64  `json:",omitempty"`
+	UpdatedAt      time.Time
+}
+
+// TelegramLink is a one-time code which user sends to the bot as "/start <code>", it proves that the chat belongs to the user
+type TelegramLink struct {
+	UserAddr string
+	ExpireAt time.Time
+}
+
+// Notification is a single delivery to one channel, it is kept as a delivery log after completion
+type Notification struct {
+	ID       string
+	UserAddr string
+	Channel  string
+	Event    string
+	FileName string
+	Payload  []byte
+	// WebhookID is set for deliveries to user's lifecycle webhook
+	WebhookID string `json:",omitempty"`
+
+	Status      string
+	Attempts    int
+	LastError   string `json:",omitempty"`
+	NextAt      time.Time
+	CreatedAt   time.Time
+	DeliveredAt *time.Time `json:",omitempty"`
+}
+
+// SetNotifySettings stores user's notification settings, telegram chat is kept as it is stored,
+// it is changed only by SetTelegramChat after the chat is linked by the bot
+func (d *Database) SetNotifySettings(userAddr string, settings NotifySettings) error {
+	d.mx.Lock() // not allow concurrent chat link to be overwritten
+	defer d.mx.Unlock()
+
+	old, err := d.GetNotifySettings(userAddr)
+	if err != nil {
+		return err
+	}
+
+	settings.TelegramChatID = 0
+	if old != nil {
+		settings.TelegramChatID = old.TelegramChatID
+	}
+	return d.putNotifySettings(userAddr, settings)
+}
+
+// SetTelegramChat sets telegram chat of the user, zero unlinks it. When user has no settings yet,
+// they are created with the given thresholds
+func (d *Database) SetTelegramChat(userAddr string, chatID int64, thresholds []uint32) error {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	settings, err := d.GetNotifySettings(userAddr)
+	if err != nil {
+		return err
+	}
+	if settings == nil {
+		if chatID == 0 {
+			return nil
+		}
+		settings = &NotifySettings{ThresholdDays: thresholds}
+	}
+
+	settings.TelegramChatID = chatID
+	settings.UpdatedAt = time.Now()
+	return d.putNotifySettings(userAddr, *settings)
+}
+
+func (d *Database) putNotifySettings(userAddr string, settings NotifySettings) error {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notify settings: %w", err)
+	}
+
+	if err = d.db.Put([]byte("notify:"+userAddr), data, &opt.WriteOptions{Sync: true}); err != nil {
+		d.logger.Error().Err(err).Str("addr", userAddr).Msg("failed to store notify settings")
+		return fmt.Errorf("failed to store notify settings: %w", err)
+	}
+	return nil
+}
+
+// GetNotifySettings retrieves user's notification settings, nil is returned when they were never set
+func (d *Database) GetNotifySettings(userAddr string) (*NotifySettings, error) {
+	data, err := d.db.Get([]byte("notify:"+userAddr), nil)
+	if err != nil {
+		if errors.Is(err, leveldb.ErrNotFound) {
+			return nil, nil
+		}
+		d.logger.Error().Err(err).Str("addr", userAddr).Msg("failed to retrieve notify settings")
+		return nil, fmt.Errorf("failed to retrieve notify settings: %w", err)
+	}
+
+	var settings NotifySettings
+	if err = json.Unmarshal(data, &settings); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal notify settings: %w", err)
+	}
+	return &settings, nil
+}
+
+// CreateTelegramLink stores link code, expired codes are removed in the same batch
+func (d *Database) CreateTelegramLink(code string, link TelegramLink) error {
+	data, err := json.Marshal(link)
+	if err != nil {
+		return fmt.Errorf("failed to marshal telegram link: %w", err)
+	}
+
+	batch := new(leveldb.Batch)
+
+	now := time.Now()
+	iter := d.db.NewIterator(util.BytesPrefix([]byte("telegram-link:")), nil)
+	for iter.Next() {
+		var l TelegramLink
+		if err = json.Unmarshal(iter.Value(), &l); err != nil || l.ExpireAt.Before(now) {
+			batch.Delete(append([]byte{}, iter.Key()...))
+		}
+	}
+	iter.Release()
+	if err = iter.Error(); err != nil {
+		d.logger.Error().Err(err).Msg("iterator error while cleaning telegram links")
+		return fmt.Errorf("failed to iterate telegram links: %w", err)
+	}
+
+	batch.Put([]byte("telegram-link:"+code), data)
+	if err = d.db.Write(batch, &opt.WriteOptions{Sync: true}); err != nil {
+		d.logger.Error().Err(err).Str("addr", link.UserAddr).Msg("failed to store telegram link")
+		return fmt.Errorf("failed to store telegram link: %w", err)
+	}
+	return nil
+}
+
+// UseTelegramLink removes link code and returns it, nil is returned when code is unknown or expired
+func (d *Database) UseTelegramLink(code string) (*TelegramLink, error) {
+	key := []byte("telegram-link:" + code)
+
+	d.mx.Lock() // code can be used only once
+	defer d.mx.Unlock()
+
+	data, err := d.db.Get(key, nil)
+	if err != nil {
+		if errors.Is(err, leveldb.ErrNotFound) {
+			return nil, nil
+		}
+		d.logger.Error().Err(err).Msg("failed to retrieve telegram link")
+		return nil, fmt.Errorf("failed to retrieve telegram link: %w", err)
+	}
+
+	if err = d.db.Delete(key, &opt.WriteOptions{Sync: true}); err != nil {
+		d.logger.Error().Err(err).Msg("failed to remove telegram link")
+		return nil, fmt.Errorf("failed to remove telegram link: %w", err)
+	}
+
+	var link TelegramLink
+	if err = json.Unmarshal(data, &link); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal telegram link: %w", err)
+	}
+	if link.ExpireAt.Before(time.Now()) {
+		return nil, nil
+	}
+	return &link, nil
+}
+
+// AddNotification stores pending notification, notifications of the same user older than retention are removed in the same batch
+func (d *Database) AddNotification(n Notification, retention time.Duration) error {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+
+	batch := new(leveldb.Batch)
+
+	// keys are ordered by time, so expired ones are at the beginning
+	iter := d.db.NewIterator(&util.Range{
+		Start: []byte("notification:" + n.UserAddr + ":"),
+		Limit: []byte(notificationKey(n.UserAddr, n.CreatedAt.Add(-retention), "")),
+	}, nil)
+	for iter.Next() {
+		batch.Delete(append([]byte{}, iter.Key()...))
+	}
+	iter.Release()
+	if err = iter.Error(); err != nil {
+		d.logger.Error().Err(err).Str("addr", n.UserAddr).Msg("iterator error while cleaning notifications")
+		return fmt.Errorf("failed to iterate notifications: %w", err)
+	}
+
+	key := notificationKey(n.UserAddr, n.CreatedAt, n.ID)
+	batch.Put([]byte(key), data)
+	batch.Put([]byte("notification-pending:"+n.ID), []byte(key))
+	if err = d.db.Write(batch, &opt.WriteOptions{Sync: true}); err != nil {
+		d.logger.Error().Err(err).Str("addr", n.UserAddr).Msg("failed to store notification")
+		return fmt.Errorf("failed to store notification: %w", err)
+	}
+	return nil
+}
+
+// UpdateNotification stores result of delivery attempt, notification is removed from pending when it is completed
+func (d *Database) UpdateNotification(n Notification) error {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+
+	batch := new(leveldb.Batch)
+	batch.Put([]byte(notificationKey(n.UserAddr, n.CreatedAt, n.ID)), data)
+	if n.Status != NotificationPending {
+		batch.Delete([]byte("notification-pending:" + n.ID))
+	}
+
+	if err = d.db.Write(batch, &opt.WriteOptions{Sync: true}); err != nil {
+		d.logger.Error().Err(err).Str("id", n.ID).Msg("failed to update notification")
+		return fmt.Errorf("failed to update notification: %w", err)
+	}
+	return nil
+}
+
+// GetDueNotifications returns pending notifications which next attempt time has come
+func (d *Database) GetDueNotifications(now time.Time) ([]Notification, error) {
+	iter := d.db.NewIterator(util.BytesPrefix([]byte("notification-pending:")), nil)
+	defer iter.Release()
+
+	var list []Notification
+	for iter.Next() {
+		data, err := d.db.Get(iter.Value(), nil)
+		if err != nil {
+			if errors.Is(err, leveldb.ErrNotFound) {
+				// removed by retention, nothing to deliver
+				continue
+			}
+			return nil, fmt.Errorf("failed to retrieve notification: %w", err)
+		}
+
+		var n Notification
+		if err = json.Unmarshal(data, &n); err != nil {
+			d.logger.Error().Err(err).Str("key", string(iter.Value())).Msg("failed to unmarshal notification")
+			continue
+		}
+
+		if n.NextAt.After(now) {
+			continue
+		}
+		list = append(list, n)
+	}
+
+	if err := iter.Error(); err != nil {
+		d.logger.Error().Err(err).Msg("iterator error while retrieving pending notifications")
+		return nil, err
+	}
+	return list, nil
+}
+
+// GetNotification retrieves notification of the user by id, nil is returned when not found or removed by retention
+func (d *Database) GetNotification(userAddr, id string) (*Notification, error) {
+	iter := d.db.NewIterator(util.BytesPrefix([]byte("notification:"+userAddr+":")), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		if !strings.HasSuffix(string(iter.Key()), ":"+id) {
+			continue
+		}
+
+		var n Notification
+		if err := json.Unmarshal(iter.Value(), &n); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal notification: %w", err)
+		}
+		return &n, nil
+	}
+
+	if err := iter.Error(); err != nil {
+		d.logger.Error().Err(err).Str("addr", userAddr).Msg("iterator error while retrieving notification")
+		return nil, err
+	}
+	return nil, nil
+}
+
+// GetNotifications returns notifications of the user from newest to oldest, created before the given time when it is not zero.
+// When webhookID is not empty, only deliveries to this webhook are returned
+func (d *Database) GetNotifications(userAddr, webhookID string, before time.Time, limit int) ([]Notification, error) {
+	rng := util.BytesPrefix([]byte("notification:" + userAddr + ":"))
+	if !before.IsZero() {
+		rng.Limit = []byte(notificationKey(userAddr, before, ""))
+	}
+
+	iter := d.db.NewIterator(rng, nil)
+	defer iter.Release()
+
+	var list []Notification
+	for ok := iter.Last(); ok && len(list) < limit; ok = iter.Prev() {
+		var n Notification
+		if err := json.Unmarshal(iter.Value(), &n); err != nil {
+			d.logger.Error().Err(err).Str("key", string(iter.Key())).Msg("failed to unmarshal notification")
+			continue
+		}
+		if webhookID != "" && n.WebhookID != webhookID {
+			continue
+		}
+		list = append(list, n)
+	}
+
+	if err := iter.Error(); err != nil {
+		d.logger.Error().Err(err).Str("addr", userAddr).Msg("iterator error while retrieving notifications")
+		return nil, err
+	}
+	return list, nil
+}
+
+func notificationKey(user string, at time.Time, id string) string {
+	return fmt.Sprintf("notification:%s:%020d:%s", user, at.UnixNano(), id)
+}
@@ -0,0 +1,102 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"strings"
+)
+
+const (
+	PlanSourceConfig = "config"
+	PlanSourceAdmin  = "admin"
+)
+
+// Plan describes user limits, zero value of a field means unlimited
+type Plan struct {
+	MaxBytes      uint64 `json:"max_bytes"`
+	MaxFiles      uint64 `json:"max_files"`
+	MaxPending    uint64 `json:"max_pending"`
+	MaxUploadSize uint64 `json:"max_upload_size"`
+}
+
+// PlanOverride replaces limits of the default plan for the user, nil field means that the default plan value is used,
+// and zero means unlimited
+type PlanOverride struct {
+	MaxBytes      *uint64 `json:"max_bytes,omitempty"`
+	MaxFiles      *uint64 `json:"max_files,omitempty"`
+	MaxPending    *uint64 `json:"max_pending,omitempty"`
+	MaxUploadSize *uint64 `json:"max_upload_size,omitempty"`
+
+	// Source is where override came from, overrides from config are removed on start when they are not in config anymore
+	Source string `json:"source,omitempty"`
+}
+
+// SetUserPlan stores plan override for the user
+func (d *Database) SetUserPlan(userID string, plan PlanOverride) error {
+	data, err := json.Marshal(plan)
+	if err != nil {
+		return fmt.Errorf("failed to marshal plan: %w", err)
+	}
+
+	if err = d.db.Put([]byte("plan:"+userID), data, &opt.WriteOptions{Sync: true}); err != nil {
+		d.logger.Error().Err(err).Str("id", userID).Msg("failed to store plan")
+		return fmt.Errorf("failed to store plan: %w", err)
+	}
+	return nil
+}
+
+// GetUserPlan retrieves plan override for the user, nil is returned when there is no override
+func (d *Database) GetUserPlan(userID string) (*PlanOverride, error) {
+	data, err := d.db.Get([]byte("plan:"+userID), nil)
+	if err != nil {
+		if errors.Is(err, leveldb.ErrNotFound) {
+			return nil, nil
+		}
+		d.logger.Error().Err(err).Str("id", userID).Msg("failed to retrieve plan")
+		return nil, fmt.Errorf("failed to retrieve plan: %w", err)
+	}
+
+	return unmarshalPlanOverride(data)
+}
+
+// GetUserPlans returns all plan overrides by user
+func (d *Database) GetUserPlans() (map[string]*PlanOverride, error) {
+	iter := d.db.NewIterator(util.BytesPrefix([]byte("plan:")), nil)
+	defer iter.Release()
+
+	list := map[string]*PlanOverride{}
+	for iter.Next() {
+		plan, err := unmarshalPlanOverride(iter.Value())
+		if err != nil {
+			d.logger.Error().Err(err).Str("key", string(iter.Key())).Msg("failed to unmarshal plan")
+			continue
+		}
+		list[strings.TrimPrefix(string(iter.Key()), "plan:")] = plan
+	}
+
+	if err := iter.Error(); err != nil {
+		d.logger.Error().Err(err).Msg("iterator error while retrieving plans")
+		return nil, err
+	}
+	return list, nil
+}
+
+// DeleteUserPlan removes plan override, so the default plan is used for the user
+func (d *Database) DeleteUserPlan(userID string) error {
+	if err := d.db.Delete([]byte("plan:"+userID), &opt.WriteOptions{Sync: true}); err != nil {
+		return fmt.Errorf("failed to delete plan: %w", err)
+	}
+	return nil
+}
+
+func unmarshalPlanOverride(data []byte) (*PlanOverride, error) {
+	var plan PlanOverride
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal plan: %w", err)
+	}
+	return &plan, nil
+}
@@ -0,0 +1,58 @@
+package db
+
+import (
+	"fmt"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UseProofPayload marks login proof payload as used, returns false when it was already used before.
+// Records of expired payloads are removed in the same batch, they cannot be accepted anyway.
+func (d *Database) UseProofPayload(nonce string, expireAt time.Time) (bool, error) {
+	key := fmt.Sprintf("proof-used:%d:%s", expireAt.Unix(), nonce)
+
+	d.mx.Lock() // not allow concurrency to bypass Has verification
+	defer d.mx.Unlock()
+
+	exists, err := d.db.Has([]byte(key), nil)
+	if err != nil {
+		d.logger.Error().Err(err).Str("key", key).Msg("failed to check used proof payload")
+		return false, fmt.Errorf("failed to check used proof payload: %w", err)
+	}
+
+	if exists {
+		return false, nil
+	}
+
+	batch := new(leveldb.Batch)
+
+	// keys are sorted by expiration time, so we can stop at the first not expired one
+	now := time.Now().Unix()
+	iter := d.db.NewIterator(util.BytesPrefix([]byte("proof-used:")), nil)
+	for iter.Next() {
+		keyParts := strings.SplitN(string(iter.Key()), ":", 3)
+		if len(keyParts) == 3 {
+			at, err := strconv.ParseInt(keyParts[1], 10, 64)
+			if err == nil && at >= now {
+				break
+			}
+		}
+		batch.Delete(append([]byte{}, iter.Key()...))
+	}
+	iter.Release()
+	if err = iter.Error(); err != nil {
+		d.logger.Error().Err(err).Msg("iterator error while cleaning used proof payloads")
+		return false, fmt.Errorf("failed to iterate used proof payloads: %w", err)
+	}
+
+	batch.Put([]byte(key), []byte{})
+	if err = d.db.Write(batch, &opt.WriteOptions{Sync: true}); err != nil {
+		d.logger.Error().Err(err).Str("key", key).Msg("failed to store used proof payload")
+		return false, fmt.Errorf("failed to store used proof payload: %w", err)
+	}
+	return true, nil
+}
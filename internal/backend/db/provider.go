@@ -0,0 +1,184 @@
+package db
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"time"
+)
+
+// StorageProvider is a provider which can be chosen for storage contracts
+type StorageProvider struct {
+	Key       []byte
+	Name      string
+	AddedBy   string
+	CreatedAt time.Time
+	// Disabled provider is not offered for new contracts, but existing contracts with it are still tracked
+	Disabled bool
+}
+
+// ProviderRates is a result of a single provider poll, rates are big-endian nanoTON as returned by provider
+type ProviderRates struct {
+	Key              []byte
+	Reachable        bool
+	Error            string `json:",omitempty"`
+	Available        bool
+	RatePerMBDay     []byte
+	MinBounty        []byte
+	SpaceAvailableMB uint64
+	MinSpan          uint32
+	MaxSpan          uint32
+	CheckedAt        time.Time
+}
+
+// AddProvider stores provider, existing provider with the same key is replaced
+func (d *Database) AddProvider(p StorageProvider) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return fmt.Errorf("failed to marshal provider: %w", err)
+	}
+
+	if err = d.db.Put([]byte("provider:"+hex.EncodeToString(p.Key)), data, &opt.WriteOptions{Sync: true}); err != nil {
+		d.logger.Error().Err(err).Hex("key", p.Key).Msg("failed to store provider")
+		return fmt.Errorf("failed to store provider: %w", err)
+	}
+	return nil
+}
+
+// SeedProvider stores provider only when it is not known yet, to keep name and history of existing one
+func (d *Database) SeedProvider(p StorageProvider) error {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	exists, err := d.db.Has([]byte("provider:"+hex.EncodeToString(p.Key)), nil)
+	if err != nil {
+		return fmt.Errorf("failed to check provider existence: %w", err)
+	}
+	if exists {
+		return nil
+	}
+	return d.AddProvider(p)
+}
+
+// GetProvider retrieves provider, nil is returned when not found
+func (d *Database) GetProvider(key []byte) (*StorageProvider, error) {
+	data, err := d.db.Get([]byte("provider:"+hex.EncodeToString(key)), nil)
+	if err != nil {
+		if errors.Is(err, leveldb.ErrNotFound) {
+			return nil, nil
+		}
+		d.logger.Error().Err(err).Hex("key", key).Msg("failed to retrieve provider")
+		return nil, fmt.Errorf("failed to retrieve provider: %w", err)
+	}
+
+	var p StorageProvider
+	if err = json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal provider: %w", err)
+	}
+	return &p, nil
+}
+
+// GetProviders returns all known providers ordered by key
+func (d *Database) GetProviders() ([]StorageProvider, error) {
+	iter := d.db.NewIterator(util.BytesPrefix([]byte("provider:")), nil)
+	defer iter.Release()
+
+	var list []StorageProvider
+	for iter.Next() {
+		var p StorageProvider
+		if err := json.Unmarshal(iter.Value(), &p); err != nil {
+			d.logger.Error().Err(err).Str("key", string(iter.Key())).Msg("failed to unmarshal provider")
+			continue
+		}
+		list = append(list, p)
+	}
+
+	if err := iter.Error(); err != nil {
+		d.logger.Error().Err(err).Msg("iterator error while retrieving providers")
+		return nil, err
+	}
+	return list, nil
+}
+
+// AddProviderRates stores poll result, results older than retention are removed in the same batch
+func (d *Database) AddProviderRates(rates ProviderRates, retention time.Duration) error {
+	data, err := json.Marshal(rates)
+	if err != nil {
+		return fmt.Errorf("failed to marshal provider rates: %w", err)
+	}
+
+	keyHex := hex.EncodeToString(rates.Key)
+	batch := new(leveldb.Batch)
+
+	iter := d.db.NewIterator(&util.Range{
+		Start: []byte("provider-rates:" + keyHex + ":"),
+		Limit: []byte(providerRatesKey(keyHex, rates.CheckedAt.Add(-retention))),
+	}, nil)
+	for iter.Next() {
+		batch.Delete(append([]byte{}, iter.Key()...))
+	}
+	iter.Release()
+	if err = iter.Error(); err != nil {
+		return fmt.Errorf("failed to iterate provider rates: %w", err)
+	}
+
+	batch.Put([]byte(providerRatesKey(keyHex, rates.CheckedAt)), data)
+	if err = d.db.Write(batch, &opt.WriteOptions{Sync: false}); err != nil {
+		d.logger.Error().Err(err).Hex("key", rates.Key).Msg("failed to store provider rates")
+		return fmt.Errorf("failed to store provider rates: %w", err)
+	}
+	return nil
+}
+
+// GetProviderRates returns poll results of the provider since the given time, from oldest to newest
+func (d *Database) GetProviderRates(key []byte, since time.Time) ([]ProviderRates, error) {
+	keyHex := hex.EncodeToString(key)
+	rng := util.BytesPrefix([]byte("provider-rates:" + keyHex + ":"))
+	rng.Start = []byte(providerRatesKey(keyHex, since))
+
+	iter := d.db.NewIterator(rng, nil)
+	defer iter.Release()
+
+	var list []ProviderRates
+	for iter.Next() {
+		var rates ProviderRates
+		if err := json.Unmarshal(iter.Value(), &rates); err != nil {
+			d.logger.Error().Err(err).Str("key", string(iter.Key())).Msg("failed to unmarshal provider rates")
+			continue
+		}
+		list = append(list, rates)
+	}
+
+	if err := iter.Error(); err != nil {
+		d.logger.Error().Err(err).Hex("key", key).Msg("iterator error while retrieving provider rates")
+		return nil, err
+	}
+	return list, nil
+}
+
+// GetLastProviderRates returns the latest poll result of the provider, nil is returned when it was not polled yet
+func (d *Database) GetLastProviderRates(key []byte) (*ProviderRates, error) {
+	iter := d.db.NewIterator(util.BytesPrefix([]byte("provider-rates:"+hex.EncodeToString(key)+":")), nil)
+	defer iter.Release()
+
+	if !iter.Last() {
+		if err := iter.Error(); err != nil && !errors.Is(err, leveldb.ErrNotFound) {
+			return nil, fmt.Errorf("failed to iterate provider rates: %w", err)
+		}
+		return nil, nil
+	}
+
+	var rates ProviderRates
+	if err := json.Unmarshal(iter.Value(), &rates); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal provider rates: %w", err)
+	}
+	return &rates, nil
+}
+
+func providerRatesKey(keyHex string, at time.Time) string {
+	return fmt.Sprintf("provider-rates:%s:%020d", keyHex, at.UnixNano())
+}
@@ -0,0 +1,108 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"time"
+)
+
+type Session struct {
+	ID        string
+	OwnerAddr string
+	Domain    string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// CreateSession stores a new session, expired sessions of the same user are removed in the same batch
+func (d *Database) CreateSession(session Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+
+	batch := new(leveldb.Batch)
+
+	iter := d.db.NewIterator(util.BytesPrefix([]byte("session:"+session.OwnerAddr+":")), nil)
+	for iter.Next() {
+		var s Session
+		if err = json.Unmarshal(iter.Value(), &s); err != nil || time.Now().After(s.ExpiresAt) {
+			batch.Delete(append([]byte{}, iter.Key()...))
+		}
+	}
+	iter.Release()
+	if err = iter.Error(); err != nil {
+		d.logger.Error().Err(err).Str("addr", session.OwnerAddr).Msg("iterator error while cleaning sessions")
+		return fmt.Errorf("failed to iterate sessions: %w", err)
+	}
+
+	batch.Put([]byte(sessionKey(session.OwnerAddr, session.ID)), data)
+	if err = d.db.Write(batch, &opt.WriteOptions{Sync: true}); err != nil {
+		d.logger.Error().Err(err).Str("addr", session.OwnerAddr).Msg("failed to store session")
+		return fmt.Errorf("failed to store session: %w", err)
+	}
+	return nil
+}
+
+// GetSession returns active session, nil is returned when session is not exists, revoked or expired
+func (d *Database) GetSession(userAddr, id string) (*Session, error) {
+	key := sessionKey(userAddr, id)
+
+	data, err := d.db.Get([]byte(key), nil)
+	if err != nil {
+		if errors.Is(err, leveldb.ErrNotFound) {
+			return nil, nil
+		}
+		d.logger.Error().Err(err).Str("key", key).Msg("failed to retrieve session")
+		return nil, fmt.Errorf("failed to retrieve session: %w", err)
+	}
+
+	var session Session
+	if err = json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal session: %w", err)
+	}
+
+	if time.Now().After(session.ExpiresAt) {
+		if err = d.db.Delete([]byte(key), nil); err != nil {
+			d.logger.Warn().Err(err).Str("key", key).Msg("failed to delete expired session")
+		}
+		return nil, nil
+	}
+	return &session, nil
+}
+
+// RevokeSession deletes a single session of the user
+func (d *Database) RevokeSession(userAddr, id string) error {
+	if err := d.db.Delete([]byte(sessionKey(userAddr, id)), &opt.WriteOptions{Sync: true}); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+// RevokeAllSessions deletes every session of the user, returns number of revoked sessions
+func (d *Database) RevokeAllSessions(userAddr string) (int, error) {
+	batch := new(leveldb.Batch)
+
+	iter := d.db.NewIterator(util.BytesPrefix([]byte("session:"+userAddr+":")), nil)
+	for iter.Next() {
+		batch.Delete(append([]byte{}, iter.Key()...))
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		d.logger.Error().Err(err).Str("addr", userAddr).Msg("iterator error while revoking sessions")
+		return 0, fmt.Errorf("failed to iterate sessions: %w", err)
+	}
+
+	if err := d.db.Write(batch, &opt.WriteOptions{Sync: true}); err != nil {
+		return 0, fmt.Errorf("failed to delete sessions: %w", err)
+	}
+	return batch.Len(), nil
+}
+
+func sessionKey(user, id string) string {
+	return "session:" + user + ":" + id
+}
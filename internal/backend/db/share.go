@@ -0,0 +1,133 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"time"
+)
+
+var ErrShareLinkExhausted = errors.New("share link is expired or download limit reached")
+
+type ShareLink struct {
+	ID           string
+	OwnerAddr    string
+	FileName     string
+	BagID        []byte
+	CreatedAt    time.Time
+	ExpiresAt    *time.Time
+	MaxDownloads uint64
+	Downloads    uint64
+
+	PasswordHash []byte
+	PasswordSalt []byte
+}
+
+// Active returns true when link is not expired and download limit is not reached
+func (l *ShareLink) Active() bool {
+	if l.ExpiresAt != nil && time.Now().After(*l.ExpiresAt) {
+		return false
+	}
+	return l.MaxDownloads == 0 || l.Downloads < l.MaxDownloads
+}
+
+// CreateShareLink stores link and its user index record in a single batch
+func (d *Database) CreateShareLink(link ShareLink) error {
+	data, err := json.Marshal(link)
+	if err != nil {
+		return fmt.Errorf("failed to marshal share link: %w", err)
+	}
+
+	batch := new(leveldb.Batch)
+	batch.Put([]byte("share:"+link.ID), data)
+	batch.Put([]byte("share-user:"+link.OwnerAddr+":"+link.ID), nil)
+	if err = d.db.Write(batch, &opt.WriteOptions{Sync: true}); err != nil {
+		d.logger.Error().Err(err).Str("id", link.ID).Msg("failed to store share link")
+		return fmt.Errorf("failed to store share link: %w", err)
+	}
+	return nil
+}
+
+// GetShareLink retrieves share link by id, nil is returned when not found
+func (d *Database) GetShareLink(id string) (*ShareLink, error) {
+	data, err := d.db.Get([]byte("share:"+id), nil)
+	if err != nil {
+		if errors.Is(err, leveldb.ErrNotFound) {
+			return nil, nil
+		}
+		d.logger.Error().Err(err).Str("id", id).Msg("failed to retrieve share link")
+		return nil, fmt.Errorf("failed to retrieve share link: %w", err)
+	}
+
+	var link ShareLink
+	if err = json.Unmarshal(data, &link); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal share link: %w", err)
+	}
+	return &link, nil
+}
+
+// GetShareLinksByUser retrieves all share links created by the user, including not active ones
+func (d *Database) GetShareLinksByUser(userID string) ([]ShareLink, error) {
+	var list []ShareLink
+
+	prefix := "share-user:" + userID + ":"
+	iter := d.db.NewIterator(util.BytesPrefix([]byte(prefix)), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		link, err := d.GetShareLink(string(iter.Key())[len(prefix):])
+		if err != nil {
+			return nil, err
+		}
+		if link == nil {
+			continue
+		}
+		list = append(list, *link)
+	}
+
+	if err := iter.Error(); err != nil {
+		d.logger.Error().Err(err).Str("userID", userID).Msg("iterator error while retrieving share links")
+		return nil, err
+	}
+	return list, nil
+}
+
+// UseShareLink increments downloads counter, ErrShareLinkExhausted is returned when link is not active anymore
+func (d *Database) UseShareLink(id string) error {
+	d.mx.Lock() // not allow concurrency to bypass limit verification
+	defer d.mx.Unlock()
+
+	link, err := d.GetShareLink(id)
+	if err != nil {
+		return err
+	}
+	if link == nil || !link.Active() {
+		return ErrShareLinkExhausted
+	}
+
+	link.Downloads++
+
+	data, err := json.Marshal(link)
+	if err != nil {
+		return fmt.Errorf("failed to marshal share link: %w", err)
+	}
+
+	if err = d.db.Put([]byte("share:"+id), data, &opt.WriteOptions{Sync: false}); err != nil {
+		return fmt.Errorf("failed to update share link: %w", err)
+	}
+	return nil
+}
+
+// DeleteShareLink removes link and its user index record
+func (d *Database) DeleteShareLink(userID, id string) error {
+	batch := new(leveldb.Batch)
+	batch.Delete([]byte("share:" + id))
+	batch.Delete([]byte("share-user:" + userID + ":" + id))
+	if err := d.db.Write(batch, &opt.WriteOptions{Sync: true}); err != nil {
+		return fmt.Errorf("failed to delete share link: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"time"
+)
+
+// APIToken is stored by hash of the token, the token itself is never stored
+type APIToken struct {
+	ID         string
+	OwnerAddr  string
+	Name       string
+	Scopes     []string
+	Hash       string
+	CreatedAt  time.Time
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+}
+
+// CreateAPIToken stores token and its user index record in a single batch
+func (d *Database) CreateAPIToken(token APIToken) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("failed to marshal token: %w", err)
+	}
+
+	batch := new(leveldb.Batch)
+	batch.Put([]byte("token:"+token.Hash), data)
+	batch.Put([]byte("token-user:"+token.OwnerAddr+":"+token.ID), []byte(token.Hash))
+	if err = d.db.Write(batch, &opt.WriteOptions{Sync: true}); err != nil {
+		d.logger.Error().Err(err).Str("id", token.ID).Msg("failed to store token")
+		return fmt.Errorf("failed to store token: %w", err)
+	}
+	return nil
+}
+
+// GetAPITokenByHash retrieves token, nil is returned when not found
+func (d *Database) GetAPITokenByHash(hash string) (*APIToken, error) {
+	data, err := d.db.Get([]byte("token:"+hash), nil)
+	if err != nil {
+		if errors.Is(err, leveldb.ErrNotFound) {
+			return nil, nil
+		}
+		d.logger.Error().Err(err).Msg("failed to retrieve token")
+		return nil, fmt.Errorf("failed to retrieve token: %w", err)
+	}
+
+	var token APIToken
+	if err = json.Unmarshal(data, &token); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal token: %w", err)
+	}
+	return &token, nil
+}
+
+// GetAPITokensByUser retrieves all tokens of the user
+func (d *Database) GetAPITokensByUser(userID string) ([]APIToken, error) {
+	var list []APIToken
+
+	iter := d.db.NewIterator(util.BytesPrefix([]byte("token-user:"+userID+":")), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		token, err := d.GetAPITokenByHash(string(iter.Value()))
+		if err != nil {
+			return nil, err
+		}
+		if token == nil {
+			continue
+		}
+		list = append(list, *token)
+	}
+
+	if err := iter.Error(); err != nil {
+		d.logger.Error().Err(err).Str("userID", userID).Msg("iterator error while retrieving tokens")
+		return nil, err
+	}
+	return list, nil
+}
+
+// TouchAPIToken updates last usage time of the token
+func (d *Database) TouchAPIToken(hash string, at time.Time) error {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	token, err := d.GetAPITokenByHash(hash)
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		return nil
+	}
+
+	// token could be revoked while request was authorized, do not bring it back
+	exists, err := d.db.Has([]byte("token-user:"+token.OwnerAddr+":"+token.ID), nil)
+	if err != nil {
+		return fmt.Errorf("failed to check token index: %w", err)
+	}
+	if !exists {
+		return nil
+	}
+	token.LastUsedAt = &at
+
+	data, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("failed to marshal token: %w", err)
+	}
+
+	if err = d.db.Put([]byte("token:"+hash), data, &opt.WriteOptions{Sync: false}); err != nil {
+		return fmt.Errorf("failed to update token: %w", err)
+	}
+	return nil
+}
+
+// DeleteAPIToken removes token of the user by id, returns false when token not found
+func (d *Database) DeleteAPIToken(userID, id string) (bool, error) {
+	d.mx.Lock() // not allow concurrent touch to write token back
+	defer d.mx.Unlock()
+
+	indexKey := "token-user:" + userID + ":" + id
+
+	hash, err := d.db.Get([]byte(indexKey), nil)
+	if err != nil {
+		if errors.Is(err, leveldb.ErrNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to retrieve token index: %w", err)
+	}
+
+	batch := new(leveldb.Batch)
+	batch.Delete([]byte("token:" + string(hash)))
+	batch.Delete([]byte(indexKey))
+	if err = d.db.Write(batch, &opt.WriteOptions{Sync: true}); err != nil {
+		return false, fmt.Errorf("failed to delete token: %w", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,132 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"time"
+)
+
+// Upload represents resumable upload which is not yet complete
+type Upload struct {
+	ID        string
+	OwnerAddr string
+	FileName  string
+	Size      uint64
+	Offset    uint64
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// StoreUpload creates or updates upload record
+func (d *Database) StoreUpload(upload Upload) error {
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal upload: %w", err)
+	}
+
+	if err = d.db.Put([]byte(uploadKey(upload.OwnerAddr, upload.ID)), data, &opt.WriteOptions{Sync: false}); err != nil {
+		d.logger.Error().Err(err).Str("id", upload.ID).Msg("failed to store upload")
+		return fmt.Errorf("failed to store upload: %w", err)
+	}
+	return nil
+}
+
+// GetUpload retrieves upload record, nil is returned when not found
+func (d *Database) GetUpload(userID, id string) (*Upload, error) {
+	data, err := d.db.Get([]byte(uploadKey(userID, id)), nil)
+	if err != nil {
+		if errors.Is(err, leveldb.ErrNotFound) {
+			return nil, nil
+		}
+		d.logger.Error().Err(err).Str("id", id).Msg("failed to retrieve upload")
+		return nil, fmt.Errorf("failed to retrieve upload: %w", err)
+	}
+
+	var upload Upload
+	if err = json.Unmarshal(data, &upload); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal upload: %w", err)
+	}
+	return &upload, nil
+}
+
+// GetUploadsByUser retrieves all not completed uploads of the user
+func (d *Database) GetUploadsByUser(userID string) ([]Upload, error) {
+	return d.listUploads("upload:" + userID + ":")
+}
+
+// GetExpiredUploads retrieves uploads of all users which were not touched before expiration
+func (d *Database) GetExpiredUploads() ([]Upload, error) {
+	list, err := d.listUploads("upload:")
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []Upload
+	for _, upload := range list {
+		if time.Now().After(upload.ExpiresAt) {
+			expired = append(expired, upload)
+		}
+	}
+	return expired, nil
+}
+
+// DeleteUpload removes upload record
+func (d *Database) DeleteUpload(userID, id string) error {
+	if err := d.db.Delete([]byte(uploadKey(userID, id)), &opt.WriteOptions{Sync: false}); err != nil {
+		return fmt.Errorf("failed to delete upload: %w", err)
+	}
+	return nil
+}
+
+// CompleteUpload replaces upload record with file data and store task in a single batch
+func (d *Database) CompleteUpload(upload Upload, fileData FileInfo) error {
+	jsonData, err := json.Marshal(fileData)
+	if err != nil {
+		return fmt.Errorf("failed to marshal file data: %w", err)
+	}
+
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	batch := new(leveldb.Batch)
+	if err = d.putNewFile(batch, upload.OwnerAddr, fileData.FilePath, jsonData); err != nil {
+		return err
+	}
+	batch.Delete([]byte(uploadKey(upload.OwnerAddr, upload.ID)))
+
+	if err = d.db.Write(batch, &opt.WriteOptions{Sync: true}); err != nil {
+		d.logger.Error().Err(err).Str("id", upload.ID).Msg("failed to complete upload")
+		return fmt.Errorf("failed to complete upload: %w", err)
+	}
+	return nil
+}
+
+func (d *Database) listUploads(prefix string) ([]Upload, error) {
+	var list []Upload
+
+	iter := d.db.NewIterator(util.BytesPrefix([]byte(prefix)), nil)
+	defer iter.Release()
+
+	for iter.Next() {
+		var upload Upload
+		if err := json.Unmarshal(iter.Value(), &upload); err != nil {
+			d.logger.Error().Err(err).Str("key", string(iter.Key())).Msg("failed to unmarshal upload")
+			continue
+		}
+		list = append(list, upload)
+	}
+
+	if err := iter.Error(); err != nil {
+		d.logger.Error().Err(err).Msg("iterator error while retrieving uploads")
+		return nil, err
+	}
+	return list, nil
+}
+
+func uploadKey(user, id string) string {
+	return "upload:" + user + ":" + id
+}
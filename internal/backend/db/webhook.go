@@ -0,0 +1,83 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+	"time"
+)
+
+// Webhook is user's endpoint which receives file lifecycle events
+type Webhook struct {
+	ID        string
+	OwnerAddr string
+	URL       string
+	Secret    string
+	// Events are types of events sent to the endpoint, empty means all
+	Events    []string `json:",omitempty"`
+	CreatedAt time.Time
+}
+
+func (d *Database) CreateWebhook(w Webhook) error {
+	data, err := json.Marshal(w)
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook: %w", err)
+	}
+
+	if err = d.db.Put([]byte("webhook:"+w.OwnerAddr+":"+w.ID), data, &opt.WriteOptions{Sync: true}); err != nil {
+		d.logger.Error().Err(err).Str("addr", w.OwnerAddr).Msg("failed to store webhook")
+		return fmt.Errorf("failed to store webhook: %w", err)
+	}
+	return nil
+}
+
+// GetWebhook retrieves webhook of the user, nil is returned when not found
+func (d *Database) GetWebhook(ownerAddr, id string) (*Webhook, error) {
+	data, err := d.db.Get([]byte("webhook:"+ownerAddr+":"+id), nil)
+	if err != nil {
+		if errors.Is(err, leveldb.ErrNotFound) {
+			return nil, nil
+		}
+		d.logger.Error().Err(err).Str("addr", ownerAddr).Str("id", id).Msg("failed to retrieve webhook")
+		return nil, fmt.Errorf("failed to retrieve webhook: %w", err)
+	}
+
+	var w Webhook
+	if err = json.Unmarshal(data, &w); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal webhook: %w", err)
+	}
+	return &w, nil
+}
+
+func (d *Database) GetWebhooksByUser(ownerAddr string) ([]Webhook, error) {
+	iter := d.db.NewIterator(util.BytesPrefix([]byte("webhook:"+ownerAddr+":")), nil)
+	defer iter.Release()
+
+	var list []Webhook
+	for iter.Next() {
+		var w Webhook
+		if err := json.Unmarshal(iter.Value(), &w); err != nil {
+			d.logger.Error().Err(err).Str("key", string(iter.Key())).Msg("failed to unmarshal webhook")
+			continue
+		}
+		list = append(list, w)
+	}
+
+	if err := iter.Error(); err != nil {
+		d.logger.Error().Err(err).Str("addr", ownerAddr).Msg("iterator error while retrieving webhooks")
+		return nil, err
+	}
+	return list, nil
+}
+
+// DeleteWebhook removes webhook, its pending deliveries fail on the next attempt
+func (d *Database) DeleteWebhook(ownerAddr, id string) error {
+	if err := d.db.Delete([]byte("webhook:"+ownerAddr+":"+id), &opt.WriteOptions{Sync: true}); err != nil {
+		d.logger.Error().Err(err).Str("addr", ownerAddr).Str("id", id).Msg("failed to delete webhook")
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	return nil
+}
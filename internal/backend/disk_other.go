@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd
+
+package backend
+
+// fsSpace is not supported on this platform, zero values are omitted from disk usage
+func fsSpace(string) (uint64, uint64) {
+	return 0, 0
+}
@@ -0,0 +1,14 @@
+//go:build linux || darwin || freebsd
+
+package backend
+
+import "syscall"
+
+// fsSpace returns free and total bytes of the filesystem containing path
+func fsSpace(path string) (uint64, uint64) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, 0
+	}
+	return uint64(st.Bavail) * uint64(st.Bsize), uint64(st.Blocks) * uint64(st.Bsize)
+}
@@ -0,0 +1,91 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/xssnick/ton-provider-web/internal/backend/db"
+	"github.com/xssnick/ton-provider-web/internal/backend/storage"
+	"os"
+	"path/filepath"
+)
+
+var (
+	ErrFileNotFound = errors.New("file not found")
+	ErrPathRequired = errors.New("path inside folder is required")
+)
+
+// OpenFile opens user's file for reading, innerPath selects file inside the folder.
+// When bag is already created, file is taken from the bag location reported by storage daemon,
+// because on-disk copy could be removed after bag deduplication.
+func (s *Service) OpenFile(ctx context.Context, userAddr, fileName, innerPath string) (*os.File, string, error) {
+	fi, err := s.db.GetFile(userAddr, fileName)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get file info: %w", err)
+	}
+	if fi == nil {
+		return nil, "", ErrFileNotFound
+	}
+
+	return s.openFile(ctx, fi, innerPath)
+}
+
+func (s *Service) openFile(ctx context.Context, fi *db.FileInfo, innerPath string) (*os.File, string, error) {
+	name, inner := fi.FilePath, fi.FilePath
+	path := filepath.Join(s.storageBaseDir, fi.OwnerAddr, fi.FilePath)
+	if fi.Dir {
+		if innerPath == "" {
+			return nil, "", ErrPathRequired
+		}
+
+		rel, err := validateRelPath(innerPath)
+		if err != nil {
+			return nil, "", err
+		}
+		name, inner = filepath.Base(rel), filepath.ToSlash(rel)
+		path = filepath.Join(path, rel)
+	} else if fi.ImportBagID != nil && fi.Bag != nil && len(fi.Bag.Files) == 1 {
+		// name of imported file is chosen by user, inside the bag it has its own
+		inner = fi.Bag.Files[0].Name
+		name = filepath.Base(filepath.FromSlash(inner))
+	}
+
+	if fi.Bag != nil {
+		var err error
+		if path, err = s.bagFilePath(ctx, fi.Bag, inner); err != nil {
+			return nil, "", err
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, "", ErrFileNotFound
+		}
+		return nil, "", fmt.Errorf("failed to open file: %w", err)
+	}
+
+	return f, name, nil
+}
+
+// bagFilePath finds file on disk by its name inside the bag
+func (s *Service) bagFilePath(ctx context.Context, bag *db.Bag, name string) (string, error) {
+	details, err := s.stg.GetBag(ctx, bag.RootHash)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return "", ErrFileNotFound
+		}
+		return "", fmt.Errorf("failed to get bag details: %w", err)
+	}
+
+	if !details.Completed {
+		return "", fmt.Errorf("%w: bag is not completed", ErrBagNotReady)
+	}
+
+	for _, f := range details.Files {
+		if f.Name == name {
+			return filepath.Join(details.Path, details.DirName, filepath.FromSlash(f.Name)), nil
+		}
+	}
+	return "", ErrFileNotFound
+}
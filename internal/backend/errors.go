@@ -0,0 +1,166 @@
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/xssnick/ton-provider-web/internal/backend/db"
+	"net/http"
+)
+
+var (
+	ErrInvalidInput        = errors.New("invalid input")
+	ErrInvalidFileName     = errors.New("invalid file name")
+	ErrFileExists          = errors.New("file already exists")
+	ErrContractNotDeployed = errors.New("contract not yet deployed")
+	ErrDeployNotRequired   = errors.New("deploy not yet required")
+	ErrFileStored          = errors.New("file is paid and stored at provider")
+	ErrBagNotReady         = errors.New("bag is not ready yet")
+	ErrNotEnoughProviders  = errors.New("not enough available providers")
+)
+
+// Error codes are part of api, clients rely on them, so they should never be changed
+const (
+	CodeBadRequest       = "bad_request"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeConflict         = "conflict"
+	CodeGone             = "gone"
+	CodePayloadTooLarge  = "payload_too_large"
+	CodeTooManyRequests  = "too_many_requests"
+	CodeInternal         = "internal_error"
+	CodeUnavailable      = "service_unavailable"
+
+	CodeInvalidInput         = "invalid_input"
+	CodeInvalidFileName      = "invalid_file_name"
+	CodeFileNotFound         = "file_not_found"
+	CodeFileExists           = "file_exists"
+	CodePathRequired         = "path_required"
+	CodeContractNotDeployed  = "contract_not_deployed"
+	CodeDeployNotRequired    = "deploy_not_required"
+	CodeFileStored           = "file_stored"
+	CodeBagNotReady          = "bag_not_ready"
+	CodeFolderTooBig         = "folder_too_big"
+	CodeQuotaExceeded        = "quota_exceeded"
+	CodeUserBanned           = "user_banned"
+	CodeSessionInvalid       = "session_invalid"
+	CodeProofPayloadInvalid  = "proof_payload_invalid"
+	CodeTokenInvalid         = "token_invalid"
+	CodeTokenScope           = "token_scope"
+	CodeTokenNotFound        = "token_not_found"
+	CodeUploadNotFound       = "upload_not_found"
+	CodeUploadOffsetMismatch = "upload_offset_mismatch"
+	CodeUploadBusy           = "upload_busy"
+	CodeShareLinkNotFound    = "share_link_not_found"
+	CodeShareLinkPassword    = "share_link_password"
+	CodeShareLinkExhausted   = "share_link_exhausted"
+	CodeTooManySubscriptions = "too_many_subscriptions"
+	CodeTaskNotFound         = "task_not_found"
+	CodeUnknownTaskType      = "unknown_task_type"
+	CodeNotEnoughProviders   = "not_enough_providers"
+	CodeProviderNotFound     = "provider_not_found"
+	CodeWebhookNotFound      = "webhook_not_found"
+	CodeDeliveryNotFound     = "delivery_not_found"
+)
+
+// ErrorResponse is the body of every failed api request
+type ErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Details any    `json:"details,omitempty"`
+}
+
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            CodeBadRequest,
+	http.StatusUnauthorized:          CodeUnauthorized,
+	http.StatusForbidden:             CodeForbidden,
+	http.StatusNotFound:              CodeNotFound,
+	http.StatusMethodNotAllowed:      CodeMethodNotAllowed,
+	http.StatusConflict:              CodeConflict,
+	http.StatusGone:                  CodeGone,
+	http.StatusRequestEntityTooLarge: CodePayloadTooLarge,
+	http.StatusTooManyRequests:       CodeTooManyRequests,
+	http.StatusInternalServerError:   CodeInternal,
+	http.StatusServiceUnavailable:    CodeUnavailable,
+}
+
+// serviceErrors maps sentinel errors to statuses and codes, first match wins
+var serviceErrors = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{ErrInvalidInput, http.StatusBadRequest, CodeInvalidInput},
+	{ErrInvalidFileName, http.StatusBadRequest, CodeInvalidFileName},
+	{ErrFileNotFound, http.StatusNotFound, CodeFileNotFound},
+	{ErrFileExists, http.StatusConflict, CodeFileExists},
+	{ErrPathRequired, http.StatusBadRequest, CodePathRequired},
+	{ErrContractNotDeployed, http.StatusConflict, CodeContractNotDeployed},
+	{ErrDeployNotRequired, http.StatusConflict, CodeDeployNotRequired},
+	{ErrFileStored, http.StatusConflict, CodeFileStored},
+	{ErrBagNotReady, http.StatusConflict, CodeBagNotReady},
+	{ErrNotEnoughProviders, http.StatusServiceUnavailable, CodeNotEnoughProviders},
+	{ErrProviderNotFound, http.StatusNotFound, CodeProviderNotFound},
+	{ErrWebhookNotFound, http.StatusNotFound, CodeWebhookNotFound},
+	{ErrDeliveryNotFound, http.StatusNotFound, CodeDeliveryNotFound},
+	{ErrFolderTooBig, http.StatusRequestEntityTooLarge, CodeFolderTooBig},
+	{ErrQuotaExceeded, http.StatusForbidden, CodeQuotaExceeded},
+	{ErrUserBanned, http.StatusForbidden, CodeUserBanned},
+	{ErrSessionInvalid, http.StatusUnauthorized, CodeSessionInvalid},
+	{ErrProofPayloadInvalid, http.StatusBadRequest, CodeProofPayloadInvalid},
+	{ErrTokenInvalid, http.StatusUnauthorized, CodeTokenInvalid},
+	{ErrTokenScope, http.StatusForbidden, CodeTokenScope},
+	{ErrTokenNotFound, http.StatusNotFound, CodeTokenNotFound},
+	{ErrUploadNotFound, http.StatusNotFound, CodeUploadNotFound},
+	{ErrUploadOffsetMismatch, http.StatusConflict, CodeUploadOffsetMismatch},
+	{ErrUploadBusy, http.StatusConflict, CodeUploadBusy},
+	{ErrShareLinkNotFound, http.StatusNotFound, CodeShareLinkNotFound},
+	{ErrShareLinkPassword, http.StatusForbidden, CodeShareLinkPassword},
+	{db.ErrShareLinkExhausted, http.StatusGone, CodeShareLinkExhausted},
+	{ErrTooManySubscriptions, http.StatusTooManyRequests, CodeTooManySubscriptions},
+	{ErrTaskNotFound, http.StatusNotFound, CodeTaskNotFound},
+	{ErrUnknownTaskType, http.StatusBadRequest, CodeUnknownTaskType},
+	{db.ErrNotFound, http.StatusNotFound, CodeNotFound},
+}
+
+// writeError writes error envelope, code is derived from the status
+func writeError(w http.ResponseWriter, message string, status int) {
+	code, ok := statusCodes[status]
+	if !ok {
+		code = CodeInternal
+	}
+	writeErrorResponse(w, status, ErrorResponse{Code: code, Message: message})
+}
+
+// writeServiceError maps known service error to its status and code,
+// unknown errors are logged and reported as internal with the given message only
+func (s *Server) writeServiceError(w http.ResponseWriter, r *http.Request, err error, message string) {
+	for _, e := range serviceErrors {
+		if errors.Is(err, e.err) {
+			writeErrorResponse(w, e.status, ErrorResponse{Code: e.code, Message: err.Error()})
+			return
+		}
+	}
+
+	s.log(r).Error().Err(err).Msg(message)
+	writeErrorResponse(w, http.StatusInternalServerError, ErrorResponse{Code: CodeInternal, Message: message})
+}
+
+// writeJSON writes successful response, all api responses are private and should not be cached
+func (s *Server) writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.logger.Debug().Err(err).Msg("Failed to encode response")
+		return
+	}
+}
+
+func writeErrorResponse(w http.ResponseWriter, status int, resp ErrorResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,118 @@
+package backend
+
+import (
+	"errors"
+	"github.com/xssnick/ton-provider-web/internal/backend/db"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	EventFileAdded        = "file_added"
+	EventBagCreated       = "bag_created"
+	EventContractDeployed = "contract_deployed"
+	EventProviderStatus   = "provider_status"
+	// EventProviderError is sent in addition to provider_status when file status becomes error
+	EventProviderError = "provider_error"
+	EventBalance       = "balance"
+	EventFileRemoved   = "file_removed"
+)
+
+const maxSubscriptionsPerUser = 8
+
+var ErrTooManySubscriptions = errors.New("too many subscriptions")
+
+type FileEvent struct {
+	Type     string        `json:"type"`
+	FileName string        `json:"file_name"`
+	At       time.Time     `json:"at"`
+	File     *UserFileInfo `json:"file,omitempty"`
+}
+
+// eventHub delivers file events to subscribed users, slow subscribers lose events
+// and have to fall back to the list polling
+type eventHub struct {
+	subs map[string]map[chan FileEvent]struct{}
+	mx   sync.RWMutex
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{
+		subs: map[string]map[chan FileEvent]struct{}{},
+	}
+}
+
+func (h *eventHub) subscribe(userAddr string) (chan FileEvent, func(), error) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	if len(h.subs[userAddr]) >= maxSubscriptionsPerUser {
+		return nil, nil, ErrTooManySubscriptions
+	}
+
+	ch := make(chan FileEvent, 32)
+	if h.subs[userAddr] == nil {
+		h.subs[userAddr] = map[chan FileEvent]struct{}{}
+	}
+	h.subs[userAddr][ch] = struct{}{}
+
+	return ch, func() {
+		h.mx.Lock()
+		defer h.mx.Unlock()
+
+		delete(h.subs[userAddr], ch)
+		if len(h.subs[userAddr]) == 0 {
+			delete(h.subs, userAddr)
+		}
+	}, nil
+}
+
+func (h *eventHub) publish(userAddr string, ev FileEvent) {
+	h.mx.RLock()
+	defer h.mx.RUnlock()
+
+	for ch := range h.subs[userAddr] {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+// SubscribeEvents returns channel with file events of the user, returned func must be called to unsubscribe
+func (s *Service) SubscribeEvents(userAddr string) (<-chan FileEvent, func(), error) {
+	return s.events.subscribe(userAddr)
+}
+
+// publishFileEvent sends event with the actual file info, fi can be nil when file is removed
+func (s *Service) publishFileEvent(typ, key string, fi *db.FileInfo) {
+	userAddr, fileName, _ := strings.Cut(key, ":")
+
+	ev := FileEvent{
+		Type:     typ,
+		FileName: fileName,
+		At:       time.Now(),
+	}
+
+	if fi != nil {
+		info := s.toUserFileInfo(fi)
+		ev.File = &info
+	}
+
+	s.events.publish(userAddr, ev)
+	s.queueWebhookEvent(userAddr, ev)
+}
+
+// publishUpdatedFileEvent reads actual file info from db and sends event
+func (s *Service) publishUpdatedFileEvent(typ, key string) {
+	fi, err := s.db.GetFileByKey(key)
+	if err != nil {
+		s.logger.Warn().Err(err).Str("key", key).Msg("failed to get file data for event")
+		return
+	}
+	if fi == nil {
+		return
+	}
+	s.publishFileEvent(typ, key, fi)
+}
@@ -0,0 +1,160 @@
+package backend
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/xssnick/ton-provider-web/internal/backend/db"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var ErrFolderTooBig = errors.New("folder size exceeds limit")
+
+// FolderFileReader returns next file of the uploading folder with its path relative to the folder root,
+// io.EOF is returned when there are no more files
+type FolderFileReader func() (string, io.Reader, error)
+
+// StoreFolder writes all files into the temporary directory first, and moves it to the user's directory
+// only when everything is received, so the whole folder becomes a single bag.
+func (s *Service) StoreFolder(ctx context.Context, userAddr, folderName string, maxSize uint64, next FolderFileReader) error {
+	cleanName, err := validateFileName(folderName)
+	if err != nil {
+		return err
+	}
+
+	existingFile, err := s.db.GetFile(userAddr, cleanName)
+	if err != nil {
+		return fmt.Errorf("failed to check file existence: %w", err)
+	}
+	if existingFile != nil {
+		return fmt.Errorf("%w, remove it first before upload new", ErrFileExists)
+	}
+
+	if err = s.checkQuota(userAddr, 0); err != nil {
+		return err
+	}
+
+	limit, err := s.uploadLimit(userAddr)
+	if err != nil {
+		return err
+	}
+	maxSize = min(maxSize, limit)
+
+	id := make([]byte, 16)
+	if _, err = rand.Read(id); err != nil {
+		return fmt.Errorf("failed to generate upload id: %w", err)
+	}
+
+	tmpDir := s.uploadPath(hex.EncodeToString(id))
+	defer os.RemoveAll(tmpDir)
+
+	root := filepath.Join(tmpDir, cleanName)
+	if err = os.MkdirAll(root, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create folder on disk: %w", err)
+	}
+
+	var total uint64
+	var num int
+	for {
+		relPath, r, err := next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read next file: %w", err)
+		}
+
+		relPath, err = validateRelPath(relPath)
+		if err != nil {
+			return err
+		}
+
+		n, err := writeFolderFile(filepath.Join(root, relPath), io.LimitReader(r, int64(maxSize-total)+1))
+		if err != nil {
+			return err
+		}
+
+		total += uint64(n)
+		if total > maxSize {
+			return ErrFolderTooBig
+		}
+		num++
+	}
+
+	if num == 0 {
+		return fmt.Errorf("%w: folder is empty", ErrInvalidInput)
+	}
+
+	if err = os.MkdirAll(filepath.Join(s.storageBaseDir, userAddr), os.ModePerm); err != nil {
+		return err
+	}
+
+	fullPath := filepath.Join(s.storageBaseDir, userAddr, cleanName)
+	if err = os.Rename(root, fullPath); err != nil {
+		return fmt.Errorf("failed to move folder: %w", err)
+	}
+
+	fileData := db.FileInfo{
+		OwnerAddr: userAddr,
+		FilePath:  cleanName,
+		Dir:       true,
+		CreatedAt: time.Now(),
+		State:     db.FileStateNew,
+		Size:      total,
+		RequestID: getRequestInfo(ctx).ID,
+	}
+
+	if err = s.db.StoreFileInfo(userAddr, fileData); err != nil {
+		_ = os.RemoveAll(fullPath)
+		return fmt.Errorf("failed to store file metadata in database: %w", err)
+	}
+	s.publishFileEvent(EventFileAdded, userAddr+":"+cleanName, &fileData)
+
+	ctxLogger(ctx, &s.logger).Debug().Str("addr", userAddr).Str("folder", cleanName).Int("files", num).Uint64("size", total).Msg("folder stored")
+	return nil
+}
+
+func writeFolderFile(fullPath string, r io.Reader) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(fullPath), os.ModePerm); err != nil {
+		return 0, fmt.Errorf("failed to create directory on disk: %w", err)
+	}
+
+	// exclusive to reject duplicated paths
+	file, err := os.OpenFile(fullPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create file on disk: %w", err)
+	}
+	defer file.Close()
+
+	n, err := io.Copy(file, r)
+	if err != nil {
+		return n, fmt.Errorf("failed to write file content to disk: %w", err)
+	}
+	return n, nil
+}
+
+// validateRelPath checks that path is relative and stays inside the folder, returns it in os format
+func validateRelPath(p string) (string, error) {
+	if len(p) > 1000 {
+		return "", fmt.Errorf("%w: file path too long", ErrInvalidFileName)
+	}
+
+	clean := path.Clean(strings.ReplaceAll(p, "\\", "/"))
+	if clean == "." || path.IsAbs(clean) {
+		return "", fmt.Errorf("%w: %s", ErrInvalidFileName, p)
+	}
+
+	for _, part := range strings.Split(clean, "/") {
+		if part == "" || part == "." || part == ".." || strings.ContainsRune(part, 0) {
+			return "", fmt.Errorf("%w: %s", ErrInvalidFileName, p)
+		}
+	}
+	return filepath.FromSlash(clean), nil
+}
@@ -0,0 +1,114 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	readinessCheckTimeout = 5 * time.Second
+	readinessCacheTTL     = 5 * time.Second
+)
+
+type DependencyStatus struct {
+	Name      string `json:"name"`
+	OK        bool   `json:"ok"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+type ReadinessReport struct {
+	Ready        bool               `json:"ready"`
+	CheckedAt    time.Time          `json:"checked_at"`
+	Dependencies []DependencyStatus `json:"dependencies"`
+}
+
+// readinessCache prevents probes from flooding dependencies with requests
+type readinessCache struct {
+	report *ReadinessReport
+	mx     sync.Mutex
+}
+
+// CheckReadiness probes every dependency concurrently, result is cached for a few seconds
+func (s *Service) CheckReadiness(ctx context.Context) *ReadinessReport {
+	s.readiness.mx.Lock()
+	defer s.readiness.mx.Unlock()
+
+	if s.readiness.report != nil && time.Since(s.readiness.report.CheckedAt) < readinessCacheTTL {
+		return s.readiness.report
+	}
+
+	checks := []struct {
+		name string
+		fn   func(ctx context.Context) error
+	}{
+		{"leveldb", func(ctx context.Context) error {
+			return s.db.Ping()
+		}},
+		{"storage", func(ctx context.Context) error {
+			_, err := s.stg.ListBags(ctx)
+			return err
+		}},
+		{"liteserver", func(ctx context.Context) error {
+			_, err := s.api.CurrentMasterchainInfo(ctx)
+			return err
+		}},
+		{"provider", func(ctx context.Context) error {
+			_, err := s.provider.GetStorageRates(ctx, s.providerKey, 1<<20)
+			return err
+		}},
+	}
+
+	report := &ReadinessReport{
+		Ready:        true,
+		Dependencies: make([]DependencyStatus, len(checks)),
+	}
+
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, readinessCheckTimeout)
+			defer cancel()
+
+			started := time.Now()
+			err := check.fn(ctx)
+
+			st := DependencyStatus{
+				Name:      check.name,
+				OK:        err == nil,
+				LatencyMs: time.Since(started).Milliseconds(),
+			}
+			if err != nil {
+				st.Error = err.Error()
+			}
+			report.Dependencies[i] = st
+		}()
+	}
+	wg.Wait()
+
+	for _, dep := range report.Dependencies {
+		if !dep.OK {
+			report.Ready = false
+			s.logger.Warn().Str("dependency", dep.Name).Str("error", dep.Error).Msg("dependency is not ready")
+		}
+	}
+	report.CheckedAt = time.Now()
+	s.readiness.report = report
+
+	return report
+}
+
+// CheckLiveness verifies that worker is still running
+func (s *Service) CheckLiveness() error {
+	select {
+	case <-s.workerDone:
+		return fmt.Errorf("worker is stopped")
+	default:
+		return nil
+	}
+}
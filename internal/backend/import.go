@@ -0,0 +1,135 @@
+package backend
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/xssnick/ton-provider-web/internal/backend/db"
+	"github.com/xssnick/ton-provider-web/internal/backend/storage"
+	"path/filepath"
+	"time"
+)
+
+// ImportBag registers existing bag as user's file, storage daemon downloads it from the network,
+// and store task completes registration when bag header is loaded
+func (s *Service) ImportBag(ctx context.Context, userAddr, bagID, fileName string) error {
+	id, err := hex.DecodeString(bagID)
+	if err != nil || len(id) != 32 {
+		return fmt.Errorf("%w: bag id should be 32 bytes hex", ErrInvalidInput)
+	}
+
+	if fileName == "" {
+		fileName = hex.EncodeToString(id)
+	}
+
+	cleanName, err := validateFileName(fileName)
+	if err != nil {
+		return err
+	}
+
+	existingFile, err := s.db.GetFile(userAddr, cleanName)
+	if err != nil {
+		return fmt.Errorf("failed to check file existence: %w", err)
+	}
+	if existingFile != nil {
+		return fmt.Errorf("%w, remove it first before import new", ErrFileExists)
+	}
+
+	if err = s.checkQuota(userAddr, 0); err != nil {
+		return err
+	}
+
+	// bag can be already known by daemon, uploaded or imported by someone else
+	if _, err = s.stg.GetBag(ctx, id); err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			return fmt.Errorf("failed to check bag: %w", err)
+		}
+
+		if err = s.stg.AddBag(ctx, id, s.importDir(id), true); err != nil {
+			return fmt.Errorf("failed to add bag: %w", err)
+		}
+	}
+
+	fileData := db.FileInfo{
+		OwnerAddr:   userAddr,
+		FilePath:    cleanName,
+		CreatedAt:   time.Now(),
+		State:       db.FileStateNew,
+		ImportBagID: id,
+		RequestID:   getRequestInfo(ctx).ID,
+	}
+
+	if err = s.db.StoreFileInfo(userAddr, fileData); err != nil {
+		return fmt.Errorf("failed to store file metadata in database: %w", err)
+	}
+	s.publishFileEvent(EventFileAdded, userAddr+":"+cleanName, &fileData)
+
+	ctxLogger(ctx, &s.logger).Debug().Str("addr", userAddr).Str("file", cleanName).Str("bag", bagID).Msg("bag import started")
+	return nil
+}
+
+// checkImportSize verifies that imported bag, which size is known only after header is loaded, fits user's plan.
+// Imported file itself is already counted in usage with zero size
+func (s *Service) checkImportSize(userAddr string, size uint64) error {
+	plan, _, err := s.GetUserPlan(userAddr)
+	if err != nil {
+		return err
+	}
+
+	if plan.MaxUploadSize > 0 && size > plan.MaxUploadSize {
+		return fmt.Errorf("%w: file is too big", ErrQuotaExceeded)
+	}
+
+	if plan.MaxBytes > 0 {
+		usage, err := s.getUsage(userAddr)
+		if err != nil {
+			return err
+		}
+		if usage.Bytes+size > plan.MaxBytes {
+			return fmt.Errorf("%w: not enough space", ErrQuotaExceeded)
+		}
+	}
+	return nil
+}
+
+// failImport removes imported file which cannot be stored
+func (s *Service) failImport(key string, fi *db.FileInfo, reason string) {
+	log := s.fileLogger(fi)
+	log.Info().Str("key", key).Hex("id", fi.ImportBagID).Str("reason", reason).Msg("import failed, removing")
+
+	// bag is removed from daemon by cleanup
+	if err := s.db.CreateCleanTaskByKey(key); err != nil {
+		log.Error().Err(err).Str("key", key).Msg("failed to create clean task")
+		return
+	}
+
+	s.Audit(context.Background(), fi.OwnerAddr, AuditImportFailed, map[string]string{
+		"file":   fi.FilePath,
+		"bag":    hex.EncodeToString(fi.ImportBagID),
+		"reason": reason,
+	})
+}
+
+// importDir is a separate directory for every imported bag, so files of different bags with the same names do not collide
+func (s *Service) importDir(bagID []byte) string {
+	return filepath.Join(s.storageBaseDir, ".imports", hex.EncodeToString(bagID))
+}
+
+// removeImportedBag removes bag of not completed import from daemon, when no other file uses it
+func (s *Service) removeImportedBag(key string, fi *db.FileInfo) {
+	log := s.fileLogger(fi)
+
+	used, err := s.db.HasBag(fi.ImportBagID)
+	if err != nil {
+		log.Error().Err(err).Str("key", key).Msg("failed to check bag usage")
+		return
+	}
+	if used {
+		return
+	}
+
+	if err = s.stg.RemoveBag(context.Background(), fi.ImportBagID, true); err != nil && !errors.Is(err, storage.ErrNotFound) {
+		log.Error().Err(err).Hex("id", fi.ImportBagID).Str("key", key).Msg("failed to remove bag")
+	}
+}
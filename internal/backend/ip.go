@@ -0,0 +1,167 @@
+package backend
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// trustedProxies are networks of reverse proxies, which forwarding headers are taken into account
+type trustedProxies []*net.IPNet
+
+// newTrustedProxies parses list of CIDRs or single IPs
+func newTrustedProxies(list []string) (trustedProxies, error) {
+	var proxies trustedProxies
+	for _, p := range list {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid proxy ip %s", p)
+			}
+
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			p = fmt.Sprintf("%s/%d", ip, bits)
+		}
+
+		_, network, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy network %s: %w", p, err)
+		}
+		proxies = append(proxies, network)
+	}
+	return proxies, nil
+}
+
+func (t trustedProxies) trusted(ip net.IP) bool {
+	for _, network := range t {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// proxyHeaders are supported headers with client address, set by reverse proxy
+var proxyHeaders = []string{"X-Forwarded-For", "Forwarded", "X-Real-Ip"}
+
+// proxyHeaderName returns canonical name of the header with client address, X-Forwarded-For is the default
+func proxyHeaderName(name string) (string, error) {
+	if name == "" {
+		return "X-Forwarded-For", nil
+	}
+
+	name = http.CanonicalHeaderKey(name)
+	if !slices.Contains(proxyHeaders, name) {
+		return "", fmt.Errorf("unsupported proxy header %s, should be one of %s", name, strings.Join(proxyHeaders, ", "))
+	}
+	return name, nil
+}
+
+// clientIP returns address of the client, header set by proxy is used only when request came from trusted proxy.
+// Chain is walked from the right, first address which is not a trusted proxy is the client.
+// Only the configured header is read, client can send any other one and it would pass through proxy untouched
+func (s *Server) clientIP(r *http.Request) string {
+	remote := parseHostIP(r.RemoteAddr)
+	if remote == nil {
+		return r.RemoteAddr
+	}
+
+	if !s.proxies.trusted(remote) {
+		return remote.String()
+	}
+
+	chain := forwardedFor(r.Header, s.proxyHeader)
+	for i := len(chain) - 1; i >= 0; i-- {
+		ip := parseHostIP(chain[i])
+		if ip == nil {
+			// unknown or obfuscated identifier, we cannot go further
+			break
+		}
+
+		if !s.proxies.trusted(ip) {
+			return ip.String()
+		}
+		remote = ip
+	}
+	return remote.String()
+}
+
+// forwardedFor returns chain of client addresses from the header, all its lines are joined in order
+func forwardedFor(h http.Header, header string) []string {
+	var chain []string
+	for _, v := range h.Values(header) {
+		for _, elem := range strings.Split(v, ",") {
+			if header != "Forwarded" {
+				chain = append(chain, strings.TrimSpace(elem))
+				continue
+			}
+
+			for _, pair := range strings.Split(elem, ";") {
+				key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(key, "for") {
+					chain = append(chain, strings.Trim(val, `"`))
+				}
+			}
+		}
+	}
+	return chain
+}
+
+// parseHostIP parses ip with optional port, in forms like 1.2.3.4, 1.2.3.4:80, ::1, [::1] and [::1]:80
+func parseHostIP(hostPort string) net.IP {
+	if host, _, err := net.SplitHostPort(hostPort); err == nil {
+		hostPort = host
+	}
+	return net.ParseIP(strings.TrimSuffix(strings.TrimPrefix(hostPort, "["), "]"))
+}
+
+// rateLimitKey returns wallet of the authorized request when limiting by wallet is enabled, or client network otherwise
+func (s *Server) rateLimitKey(r *http.Request) string {
+	if s.rateLimitByWallet {
+		if addr := s.requestWallet(r); addr != "" {
+			return "wallet:" + addr
+		}
+	}
+	return "ip:" + ipLimitKey(s.clientIP(r))
+}
+
+// requestWallet returns owner of the session cookie or api token, only cheap checks are done,
+// request is fully authorized later by the route
+func (s *Server) requestWallet(r *http.Request) string {
+	if plain, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		owner, err := s.svc.APITokenOwner(strings.TrimSpace(plain))
+		if err != nil {
+			return ""
+		}
+		return owner
+	}
+
+	_, addr, err := s.parseSessionCookie(r)
+	if err != nil {
+		return ""
+	}
+	return addr.String()
+}
+
+// ipLimitKey groups IPv6 clients by /64, because it is usually assigned to one subscriber
+func ipLimitKey(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+
+	if v4 := parsed.To4(); v4 != nil {
+		return v4.String()
+	}
+	return parsed.Mask(net.CIDRMask(64, 128)).String() + "/64"
+}
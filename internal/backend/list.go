@@ -0,0 +1,216 @@
+package backend
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/xssnick/ton-provider-web/internal/backend/db"
+	"github.com/xssnick/tonutils-go/tlb"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SortCreated  = "created"
+	SortSize     = "size"
+	SortBalance  = "balance"
+	SortTimeLeft = "time_left"
+
+	StatusError = "error"
+
+	maxListLimit = 1000
+)
+
+type ListFilesParams struct {
+	// Status is one of processing, deploy, stored or error, empty means any
+	Status string
+	// Search is case-insensitive substring of file name
+	Search string
+	// Sort is one of Sort* constants, default is SortCreated
+	Sort string
+	Asc  bool
+	// Cursor is NextCursor of the previous page
+	Cursor string
+	// Limit is max files on page, zero means no limit
+	Limit int
+}
+
+type FilesPage struct {
+	Files []UserFileInfo
+	// NextCursor is empty on the last page
+	NextCursor string
+}
+
+type listEntry struct {
+	value uint64
+	file  db.FileInfo
+}
+
+// ListFilesByUser iterates over user's files, keeping in memory only files that can appear on the requested page
+func (s *Service) ListFilesByUser(userAddr string, params ListFilesParams) (*FilesPage, error) {
+	if params.Sort == "" {
+		params.Sort = SortCreated
+	}
+
+	switch params.Sort {
+	case SortCreated, SortSize, SortBalance, SortTimeLeft:
+	default:
+		return nil, fmt.Errorf("%w: unknown sort %s", ErrInvalidInput, params.Sort)
+	}
+
+	switch params.Status {
+	case "", StatusError:
+	default:
+		if !slices.Contains(slices.Collect(maps.Values(fileStatuses)), params.Status) {
+			return nil, fmt.Errorf("%w: unknown status %s", ErrInvalidInput, params.Status)
+		}
+	}
+
+	if params.Limit < 0 || params.Limit > maxListLimit {
+		return nil, fmt.Errorf("%w: limit should be from 1 to %d", ErrInvalidInput, maxListLimit)
+	}
+
+	var cursor *listEntry
+	if params.Cursor != "" {
+		var err error
+		if cursor, err = parseListCursor(params); err != nil {
+			return nil, err
+		}
+	}
+
+	less := func(a, b *listEntry) bool {
+		if a.value != b.value {
+			return (a.value < b.value) == params.Asc
+		}
+		if a.file.FilePath != b.file.FilePath {
+			return (a.file.FilePath < b.file.FilePath) == params.Asc
+		}
+		return false
+	}
+
+	search := strings.ToLower(params.Search)
+
+	var fileKeys []string
+	var entries []listEntry
+	err := s.db.IterateFilesByUser(userAddr, func(file *db.FileInfo) bool {
+		if file.State <= db.FileStateBag && file.CreatedAt.Add(s.freeStore).Before(time.Now()) {
+			// should be removed
+			return true
+		}
+		fileKeys = append(fileKeys, file.FilePath)
+
+		if search != "" && !strings.Contains(strings.ToLower(file.FilePath), search) {
+			return true
+		}
+		if params.Status != "" && fileStatus(file) != params.Status {
+			return true
+		}
+
+		e := listEntry{value: listSortValue(file, params.Sort), file: *file}
+		if cursor != nil && !less(cursor, &e) {
+			return true
+		}
+		entries = append(entries, e)
+
+		// keep only the first limit+1 entries, extra one tells that there is a next page
+		if params.Limit > 0 && len(entries) > 2*(params.Limit+1) {
+			sort.Slice(entries, func(i, j int) bool { return less(&entries[i], &entries[j]) })
+			entries = entries[:params.Limit+1]
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve files for user %s: %w", userAddr, err)
+	}
+
+	if err = s.db.RefreshUserIfNeeded(userAddr, fileKeys, 5); err != nil {
+		s.logger.Warn().Err(err).Msg("failed to refresh user files")
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return less(&entries[i], &entries[j]) })
+
+	page := &FilesPage{}
+	if params.Limit > 0 && len(entries) > params.Limit {
+		entries = entries[:params.Limit]
+		last := entries[len(entries)-1]
+		page.NextCursor = makeListCursor(params, &last)
+	}
+
+	links, err := s.db.GetShareLinksByUser(userAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve share links for user %s: %w", userAddr, err)
+	}
+
+	activeLinks := map[string]int{}
+	for i := range links {
+		if links[i].Active() {
+			activeLinks[links[i].FileName]++
+		}
+	}
+
+	page.Files = make([]UserFileInfo, 0, len(entries))
+	for i := range entries {
+		userFile := s.toUserFileInfo(&entries[i].file)
+		userFile.ShareLinks = activeLinks[entries[i].file.FilePath]
+		page.Files = append(page.Files, userFile)
+	}
+	return page, nil
+}
+
+// fileStatus returns status of the file as it is shown to user, provider error is a separate status
+func fileStatus(file *db.FileInfo) string {
+	if file.State >= db.FileStateStored && file.Provider != nil && file.Provider.Status == StatusError {
+		return StatusError
+	}
+	return fileStatuses[file.State]
+}
+
+func listSortValue(file *db.FileInfo, by string) uint64 {
+	switch by {
+	case SortSize:
+		if file.Bag != nil {
+			return file.Bag.FullSize
+		}
+	case SortBalance:
+		if file.Provider != nil {
+			if balance, err := tlb.FromTON(file.Provider.Balance); err == nil {
+				return balance.Nano().Uint64()
+			}
+		}
+	case SortTimeLeft:
+		if file.Provider != nil && !file.Provider.PaidUntil.IsZero() {
+			return uint64(max(file.Provider.PaidUntil.Unix(), 0))
+		}
+	default:
+		return uint64(max(file.CreatedAt.UnixNano(), 0))
+	}
+	return 0
+}
+
+// makeListCursor encodes position of the last file on page, together with the sort it is valid for
+func makeListCursor(params ListFilesParams, last *listEntry) string {
+	data := fmt.Sprintf("%s:%t:%d:%s", params.Sort, params.Asc, last.value, last.file.FilePath)
+	return base64.RawURLEncoding.EncodeToString([]byte(data))
+}
+
+func parseListCursor(params ListFilesParams) (*listEntry, error) {
+	data, err := base64.RawURLEncoding.DecodeString(params.Cursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad cursor", ErrInvalidInput)
+	}
+
+	parts := strings.SplitN(string(data), ":", 4)
+	if len(parts) != 4 || parts[0] != params.Sort || parts[1] != strconv.FormatBool(params.Asc) {
+		return nil, fmt.Errorf("%w: cursor does not match sort", ErrInvalidInput)
+	}
+
+	value, err := strconv.ParseUint(parts[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: bad cursor", ErrInvalidInput)
+	}
+
+	return &listEntry{value: value, file: db.FileInfo{FilePath: parts[3]}}, nil
+}
@@ -0,0 +1,151 @@
+package backend
+
+import (
+	"bufio"
+	"errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/xssnick/ton-provider-web/internal/backend/db"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const metricsNamespace = "ton_provider_web"
+
+var (
+	httpRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_requests_total",
+		Help:      "Number of processed http requests by route and status code.",
+	}, []string{"route", "code"})
+
+	httpDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of http requests by route.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"route"})
+
+	rateLimitRejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "rate_limit_rejections_total",
+		Help:      "Number of requests rejected by rate limiter.",
+	}, []string{"route"})
+
+	taskQueueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Name:      "task_queue_depth",
+		Help:      "Number of tasks ready for execution by queue.",
+	}, []string{"queue"})
+
+	workerCycleDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "worker_cycle_duration_seconds",
+		Help:      "Duration of worker cycles by kind.",
+		Buckets:   []float64{.001, .005, .01, .05, .1, .5, 1, 5, 10, 30, 60, 120},
+	}, []string{"cycle"})
+
+	chainFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "chain_failures_total",
+		Help:      "Number of failed blockchain and provider calls by method.",
+	}, []string{"method"})
+
+	notificationAttempts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "notification_attempts_total",
+		Help:      "Number of notification delivery attempts by channel and result.",
+	}, []string{"channel", "result"})
+)
+
+// statsCollector reports files statistics from db on every scrape
+type statsCollector struct {
+	db *db.Database
+
+	files *prometheus.Desc
+	bytes *prometheus.Desc
+}
+
+func newStatsCollector(database *db.Database) *statsCollector {
+	return &statsCollector{
+		db: database,
+		files: prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "", "files"),
+			"Number of files by state.", []string{"state"}, nil),
+		bytes: prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "", "stored_bytes"),
+			"Total size of bags of all files.", nil, nil),
+	}
+}
+
+func (c *statsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.files
+	ch <- c.bytes
+}
+
+func (c *statsCollector) Collect(ch chan<- prometheus.Metric) {
+	stats, err := c.db.GetFilesStats()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.files, err)
+		return
+	}
+
+	for state, name := range fileStatuses {
+		ch <- prometheus.MustNewConstMetric(c.files, prometheus.GaugeValue, float64(stats.ByState[state]), name)
+	}
+	ch <- prometheus.MustNewConstMetric(c.bytes, prometheus.GaugeValue, float64(stats.Bytes))
+}
+
+// observeCycle is used as defer observeCycle("name", time.Now())
+func observeCycle(cycle string, started time.Time) {
+	workerCycleDuration.WithLabelValues(cycle).Observe(time.Since(started).Seconds())
+}
+
+// metricsHandler counts requests and their latency for the route
+func metricsHandler(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next(rec, r)
+
+		httpRequests.WithLabelValues(route, strconv.Itoa(rec.status)).Inc()
+		httpDuration.WithLabelValues(route).Observe(time.Since(started).Seconds())
+	}
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.status = code
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := r.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("hijack is not supported")
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
@@ -0,0 +1,661 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/xssnick/ton-provider-web/internal/backend/db"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ChannelWebhook  = "webhook"
+	ChannelTelegram = "telegram"
+	// ChannelEndpoint is user's webhook registered for file lifecycle events
+	ChannelEndpoint = "endpoint"
+
+	NotifyExpiry = "expiry"
+	NotifyTest   = "test"
+)
+
+const (
+	notifyRetention    = 30 * 24 * time.Hour
+	notifyTimeout      = 10 * time.Second
+	notifyMaxAttempts  = 8
+	notifyRetryBase    = 30 * time.Second
+	notifyDefaultLimit = 100
+	maxNotifyLimit     = 1000
+
+	// notifyWorkers limits concurrent deliveries, so a burst of events does not open thousands of connections
+	notifyWorkers = 16
+
+	maxThresholds    = 5
+	maxThresholdDays = 365
+
+	defaultTelegramAPI = "https://api.telegram.org"
+
+	telegramLinkTTL = 15 * time.Minute
+	// telegramPollInterval is the period of getUpdates requests, they are not long polled, so stop is not delayed
+	telegramPollInterval = 2 * time.Second
+)
+
+var defaultThresholdDays = []uint32{7, 1}
+
+// TelegramConfig is a bot which sends alerts to users' chats, alerts are not available via telegram when token is empty
+type TelegramConfig struct {
+	BotToken string `json:"bot_token"`
+	// BotName is username of the bot without @, it is used to make t.me links for linking user's chats
+	BotName string `json:"bot_name"`
+	// APIURL replaces https://api.telegram.org, useful to test delivery with a local stub
+	APIURL string `json:"api_url"`
+}
+
+// NotifyConfig configures delivery of alerts and webhooks
+type NotifyConfig struct {
+	Telegram TelegramConfig
+	// WebhookDevMode allows http and local addresses for webhooks, to test delivery with a local stub.
+	// It must never be enabled in production, users could reach internal services with it
+	WebhookDevMode bool
+	// DeniedHosts are urls or host:port of internal services, webhooks never reach them, even in dev mode
+	DeniedHosts []string
+}
+
+// NotifySettingsParams are settings set by user, telegram chat is not among them,
+// it is linked by the bot when user sends link code to it, see CreateTelegramLink
+type NotifySettingsParams struct {
+	ThresholdDays []uint32 `json:"threshold_days"`
+	WebhookURL    string   `json:"webhook_url"`
+	// RotateSecret generates new webhook secret, it is generated anyway when webhook is set for the first time
+	RotateSecret bool `json:"rotate_secret"`
+}
+
+type NotifySettings struct {
+	ThresholdDays  []uint32 `json:"threshold_days"`
+	WebhookURL     string   `json:"webhook_url"`
+	WebhookSecret  string   `json:"webhook_secret,omitempty"`
+	TelegramChatID int64    `json:"telegram_chat_id"`
+	// TelegramAvailable is false when bot is not configured on the server
+	TelegramAvailable bool       `json:"telegram_available"`
+	UpdatedAt         *time.Time `json:"updated_at"`
+}
+
+type TelegramLink struct {
+	Code string `json:"code"`
+	// URL opens the bot with the code, it is empty when bot name is not configured,
+	// then user sends "/start <code>" to the bot manually
+	URL      string    `json:"url,omitempty"`
+	ExpireAt time.Time `json:"expire_at"`
+}
+
+type NotificationInfo struct {
+	ID          string     `json:"id"`
+	Channel     string     `json:"channel"`
+	Event       string     `json:"event"`
+	FileName    string     `json:"file_name,omitempty"`
+	WebhookID   string     `json:"webhook_id,omitempty"`
+	Status      string     `json:"status"`
+	Attempts    int        `json:"attempts"`
+	LastError   string     `json:"last_error,omitempty"`
+	NextAt      *time.Time `json:"next_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+}
+
+// ExpiryAlert is the body of the webhook, telegram message is made from it too
+type ExpiryAlert struct {
+	Event         string    `json:"event"`
+	UserAddr      string    `json:"user_addr"`
+	FileName      string    `json:"file_name,omitempty"`
+	BagID         string    `json:"bag_id,omitempty"`
+	ContractAddr  string    `json:"contract_addr,omitempty"`
+	ThresholdDays uint32    `json:"threshold_days,omitempty"`
+	TimeLeft      string    `json:"time_left,omitempty"`
+	ExpireAt      time.Time `json:"expire_at"`
+	Balance       string    `json:"balance,omitempty"`
+	PerDay        string    `json:"per_day,omitempty"`
+	At            time.Time `json:"at"`
+}
+
+func (s *Service) GetNotifySettings(userAddr string) (*NotifySettings, error) {
+	settings, err := s.db.GetNotifySettings(userAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notify settings: %w", err)
+	}
+	if settings == nil {
+		return &NotifySettings{
+			ThresholdDays:     defaultThresholdDays,
+			TelegramAvailable: s.telegram.BotToken != "",
+		}, nil
+	}
+	return s.toNotifySettings(settings), nil
+}
+
+func (s *Service) SetNotifySettings(ctx context.Context, userAddr string, params NotifySettingsParams) (*NotifySettings, error) {
+	thresholds := slices.Clone(params.ThresholdDays)
+	if len(thresholds) == 0 {
+		thresholds = defaultThresholdDays
+	}
+	if len(thresholds) > maxThresholds {
+		return nil, fmt.Errorf("%w: not more than %d thresholds are allowed", ErrInvalidInput, maxThresholds)
+	}
+	for _, t := range thresholds {
+		if t == 0 || t > maxThresholdDays {
+			return nil, fmt.Errorf("%w: threshold should be from 1 to %d days", ErrInvalidInput, maxThresholdDays)
+		}
+	}
+	// from the farthest to the nearest, as alerts come
+	slices.Sort(thresholds)
+	slices.Reverse(thresholds)
+	thresholds = slices.Compact(thresholds)
+
+	if params.WebhookURL != "" {
+		if err := validateWebhookURL(params.WebhookURL); err != nil {
+			return nil, err
+		}
+		if err := s.hooks.checkURL(ctx, params.WebhookURL); err != nil {
+			return nil, err
+		}
+	}
+
+	old, err := s.db.GetNotifySettings(userAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notify settings: %w", err)
+	}
+
+	settings := db.NotifySettings{
+		ThresholdDays: thresholds,
+		WebhookURL:    params.WebhookURL,
+		UpdatedAt:     time.Now(),
+	}
+
+	if settings.WebhookURL != "" {
+		if old != nil && old.WebhookSecret != "" && !params.RotateSecret {
+			settings.WebhookSecret = old.WebhookSecret
+		} else {
+			secret := make([]byte, 32)
+			if _, err = rand.Read(secret); err != nil {
+				return nil, fmt.Errorf("failed to generate webhook secret: %w", err)
+			}
+			settings.WebhookSecret = hex.EncodeToString(secret)
+		}
+	}
+
+	if err = s.db.SetNotifySettings(userAddr, settings); err != nil {
+		return nil, fmt.Errorf("failed to store notify settings: %w", err)
+	}
+	// chat is kept by db as it is linked, here it is only for the response
+	if old != nil {
+		settings.TelegramChatID = old.TelegramChatID
+	}
+	return s.toNotifySettings(&settings), nil
+}
+
+// CreateTelegramLink returns one-time code, telegram chat which sends it to the bot as "/start <code>" becomes user's alerts chat
+func (s *Service) CreateTelegramLink(userAddr string) (*TelegramLink, error) {
+	if s.telegram.BotToken == "" {
+		return nil, fmt.Errorf("%w: telegram bot is not configured", ErrInvalidInput)
+	}
+
+	code := make([]byte, 16)
+	if _, err := rand.Read(code); err != nil {
+		return nil, fmt.Errorf("failed to generate link code: %w", err)
+	}
+
+	link := &TelegramLink{
+		Code:     hex.EncodeToString(code),
+		ExpireAt: time.Now().Add(telegramLinkTTL),
+	}
+	if s.telegram.BotName != "" {
+		link.URL = "https://t.me/" + s.telegram.BotName + "?start=" + link.Code
+	}
+
+	if err := s.db.CreateTelegramLink(link.Code, db.TelegramLink{
+		UserAddr: userAddr,
+		ExpireAt: link.ExpireAt,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to store telegram link: %w", err)
+	}
+	return link, nil
+}
+
+// UnlinkTelegram removes telegram chat from user's alert channels
+func (s *Service) UnlinkTelegram(userAddr string) error {
+	if err := s.db.SetTelegramChat(userAddr, 0, nil); err != nil {
+		return fmt.Errorf("failed to unlink telegram chat: %w", err)
+	}
+	return nil
+}
+
+// SendTestNotification queues test alert to every configured channel, to check delivery
+func (s *Service) SendTestNotification(userAddr string) error {
+	settings, err := s.db.GetNotifySettings(userAddr)
+	if err != nil {
+		return fmt.Errorf("failed to get notify settings: %w", err)
+	}
+	if settings == nil || (settings.WebhookURL == "" && settings.TelegramChatID == 0) {
+		return fmt.Errorf("%w: no notification channels configured", ErrInvalidInput)
+	}
+
+	now := time.Now()
+	return s.queueNotification(settings, ExpiryAlert{
+		Event:    NotifyTest,
+		UserAddr: userAddr,
+		ExpireAt: now,
+		At:       now,
+	})
+}
+
+// ListNotifications returns user's delivery log from newest to oldest, before is the time of the last entry of the previous page
+func (s *Service) ListNotifications(userAddr string, before time.Time, limit int) ([]NotificationInfo, error) {
+	if limit <= 0 {
+		limit = notifyDefaultLimit
+	}
+	if limit > maxNotifyLimit {
+		limit = maxNotifyLimit
+	}
+
+	list, err := s.db.GetNotifications(userAddr, "", before, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve notifications: %w", err)
+	}
+
+	res := make([]NotificationInfo, 0, len(list))
+	for i := range list {
+		res = append(res, toNotificationInfo(&list[i]))
+	}
+	return res, nil
+}
+
+func toNotificationInfo(n *db.Notification) NotificationInfo {
+	info := NotificationInfo{
+		ID:          n.ID,
+		Channel:     n.Channel,
+		Event:       n.Event,
+		FileName:    n.FileName,
+		WebhookID:   n.WebhookID,
+		Status:      n.Status,
+		Attempts:    n.Attempts,
+		LastError:   n.LastError,
+		CreatedAt:   n.CreatedAt,
+		DeliveredAt: n.DeliveredAt,
+	}
+	if n.Status == db.NotificationPending {
+		at := n.NextAt
+		info.NextAt = &at
+	}
+	return info
+}
+
+func (s *Service) toNotifySettings(settings *db.NotifySettings) *NotifySettings {
+	return &NotifySettings{
+		ThresholdDays:     settings.ThresholdDays,
+		WebhookURL:        settings.WebhookURL,
+		WebhookSecret:     settings.WebhookSecret,
+		TelegramChatID:    settings.TelegramChatID,
+		TelegramAvailable: s.telegram.BotToken != "",
+		UpdatedAt:         &settings.UpdatedAt,
+	}
+}
+
+// checkExpiry returns the threshold to remember for the file and whether user should be alerted now.
+// Each threshold is alerted once, they are reset when time left grows above all of them after topup
+func checkExpiry(settings *db.NotifySettings, alerted uint32, paidUntil time.Time) (uint32, bool) {
+	if settings == nil {
+		return 0, false
+	}
+
+	left := time.Until(paidUntil)
+
+	var crossed uint32
+	for _, t := range settings.ThresholdDays {
+		if left < time.Duration(t)*24*time.Hour && (crossed == 0 || t < crossed) {
+			crossed = t
+		}
+	}
+
+	if crossed == 0 {
+		return 0, false
+	}
+	if alerted == 0 || crossed < alerted {
+		return crossed, true
+	}
+	return alerted, false
+}
+
+// queueNotification stores alert for delivery to every configured channel of the user
+func (s *Service) queueNotification(settings *db.NotifySettings, alert ExpiryAlert) error {
+	payload, err := json.Marshal(alert)
+	if err != nil {
+		return fmt.Errorf("failed to marshal alert: %w", err)
+	}
+
+	var channels []string
+	if settings.WebhookURL != "" {
+		channels = append(channels, ChannelWebhook)
+	}
+	if settings.TelegramChatID != 0 && s.telegram.BotToken != "" {
+		channels = append(channels, ChannelTelegram)
+	}
+
+	for _, ch := range channels {
+		id := make([]byte, 8)
+		_, _ = rand.Read(id)
+
+		n := db.Notification{
+			ID:        hex.EncodeToString(id),
+			UserAddr:  alert.UserAddr,
+			Channel:   ch,
+			Event:     alert.Event,
+			FileName:  alert.FileName,
+			Payload:   payload,
+			Status:    db.NotificationPending,
+			NextAt:    alert.At,
+			CreatedAt: alert.At,
+		}
+
+		if err = s.db.AddNotification(n, notifyRetention); err != nil {
+			return fmt.Errorf("failed to store notification: %w", err)
+		}
+	}
+	return nil
+}
+
+// doNotify delivers due notifications, failed deliveries are retried with exponential backoff
+func (s *Service) doNotify() {
+	defer observeCycle("notify", time.Now())
+
+	list, err := s.db.GetDueNotifications(time.Now())
+	if err != nil {
+		s.logger.Error().Err(err).Msg("failed to get pending notifications")
+		return
+	}
+	taskQueueDepth.WithLabelValues("notify").Set(float64(len(list)))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, notifyWorkers)
+	for _, n := range list {
+		if s.stopping() {
+			break
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			n.Attempts++
+			if err := s.deliverNotification(&n); err != nil {
+				notificationAttempts.WithLabelValues(n.Channel, "error").Inc()
+				s.logger.Debug().Err(err).Str("id", n.ID).Str("addr", n.UserAddr).Str("channel", n.Channel).Int("attempt", n.Attempts).Msg("failed to deliver notification")
+
+				n.LastError = err.Error()
+				if n.Attempts >= notifyMaxAttempts {
+					n.Status = db.NotificationFailed
+				} else {
+					n.NextAt = time.Now().Add(notifyRetryBase << (n.Attempts - 1))
+				}
+			} else {
+				notificationAttempts.WithLabelValues(n.Channel, "ok").Inc()
+
+				now := time.Now()
+				n.Status = db.NotificationDelivered
+				n.LastError = ""
+				n.DeliveredAt = &now
+			}
+
+			if err := s.db.UpdateNotification(n); err != nil {
+				s.logger.Error().Err(err).Str("id", n.ID).Msg("failed to update notification")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+type telegramUpdate struct {
+	UpdateID int64 `json:"update_id"`
+	Message  *struct {
+		Text string `json:"text"`
+		Chat struct {
+			ID   int64  `json:"id"`
+			Type string `json:"type"`
+		} `json:"chat"`
+	} `json:"message"`
+}
+
+// doTelegramUpdates reads messages sent to the bot and links chats by "/start <code>" messages.
+// Updates are confirmed by offset of the next request, so they are received again after restart,
+// it is safe because codes are used once. Bot should have no webhook set, getUpdates does not work with it
+func (s *Service) doTelegramUpdates() {
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+
+	var updates []telegramUpdate
+	if err := s.telegramCall(ctx, "getUpdates", map[string]any{
+		"offset":          s.telegramOffset,
+		"allowed_updates": []string{"message"},
+	}, &updates); err != nil {
+		s.logger.Debug().Err(err).Msg("failed to get telegram updates")
+		return
+	}
+
+	for _, u := range updates {
+		s.telegramOffset = u.UpdateID + 1
+		// only private chats are linked, so alerts do not go to groups where the bot was added by someone
+		if u.Message == nil || u.Message.Chat.Type != "private" {
+			continue
+		}
+
+		cmd, code, _ := strings.Cut(strings.TrimSpace(u.Message.Text), " ")
+		if cmd != "/start" {
+			continue
+		}
+
+		reply := s.linkTelegramChat(strings.TrimSpace(code), u.Message.Chat.ID)
+		if err := s.telegramCall(ctx, "sendMessage", map[string]any{
+			"chat_id": u.Message.Chat.ID,
+			"text":    reply,
+		}, nil); err != nil {
+			s.logger.Debug().Err(err).Int64("chat", u.Message.Chat.ID).Msg("failed to reply to telegram chat")
+		}
+	}
+}
+
+// linkTelegramChat sets the chat to the user of the code and returns reply for the chat
+func (s *Service) linkTelegramChat(code string, chatID int64) string {
+	if code == "" {
+		return "Open the link from notification settings on the website to receive alerts here."
+	}
+
+	link, err := s.db.UseTelegramLink(code)
+	if err != nil {
+		s.logger.Error().Err(err).Msg("failed to use telegram link")
+		return "Failed to link the chat, try again later."
+	}
+	if link == nil {
+		return "The link is invalid or expired, create a new one in notification settings on the website."
+	}
+
+	if err = s.db.SetTelegramChat(link.UserAddr, chatID, defaultThresholdDays); err != nil {
+		s.logger.Error().Err(err).Str("addr", link.UserAddr).Msg("failed to set telegram chat")
+		return "Failed to link the chat, try again later."
+	}
+
+	s.Audit(context.Background(), link.UserAddr, AuditTelegramLink, nil)
+	return fmt.Sprintf("This chat is linked to %s, alerts about expiring files will come here.", link.UserAddr)
+}
+
+// telegramCall calls bot api method, result is decoded into res when it is not nil
+func (s *Service) telegramCall(ctx context.Context, method string, params any, res any) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	apiURL := s.telegram.APIURL
+	if apiURL == "" {
+		apiURL = defaultTelegramAPI
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL+"/bot"+s.telegram.BotToken+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.notifyClient.Do(req)
+	if err != nil {
+		// url is not logged, it contains bot token
+		var ue *url.Error
+		if errors.As(err, &ue) {
+			err = ue.Err
+		}
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		OK          bool            `json:"ok"`
+		Description string          `json:"description"`
+		Result      json.RawMessage `json:"result"`
+	}
+	if err = json.NewDecoder(io.LimitReader(resp.Body, 4<<20)).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode response, status %d: %w", resp.StatusCode, err)
+	}
+	if !result.OK {
+		return fmt.Errorf("telegram error, status %d: %s", resp.StatusCode, result.Description)
+	}
+
+	if res != nil {
+		if err = json.Unmarshal(result.Result, res); err != nil {
+			return fmt.Errorf("failed to unmarshal result: %w", err)
+		}
+	}
+	return nil
+}
+
+// deliverNotification sends notification to the channel as it is configured now, so changed url or rotated secret apply to retries
+func (s *Service) deliverNotification(n *db.Notification) error {
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+
+	if n.Channel == ChannelEndpoint {
+		return s.deliverWebhookEvent(ctx, n)
+	}
+
+	settings, err := s.db.GetNotifySettings(n.UserAddr)
+	if err != nil {
+		return fmt.Errorf("failed to get notify settings: %w", err)
+	}
+
+	switch {
+	case n.Channel == ChannelWebhook && settings != nil && settings.WebhookURL != "":
+		return s.postWebhook(ctx, settings.WebhookURL, n.Payload, map[string]string{
+			"X-Webhook-ID": n.ID,
+		}, settings.WebhookSecret)
+	case n.Channel == ChannelTelegram && settings != nil && settings.TelegramChatID != 0 && s.telegram.BotToken != "":
+		var alert ExpiryAlert
+		if err = json.Unmarshal(n.Payload, &alert); err != nil {
+			return fmt.Errorf("failed to unmarshal alert: %w", err)
+		}
+
+		// telegram api url is set by operator, so it is not restricted as user's webhooks
+		return s.telegramCall(ctx, "sendMessage", map[string]any{
+			"chat_id": settings.TelegramChatID,
+			"text":    alertText(&alert),
+		}, nil)
+	default:
+		// not retried, channel was removed by user
+		n.Attempts = notifyMaxAttempts
+		return fmt.Errorf("%s channel is not configured anymore", n.Channel)
+	}
+}
+
+// postWebhook sends body to user's webhook, url is checked again, because settings could be stored
+// before restrictions were changed, and connection is made only to allowed addresses
+func (s *Service) postWebhook(ctx context.Context, to string, body []byte, headers map[string]string, secret string) error {
+	if err := s.hooks.checkURL(ctx, to); err != nil {
+		return err
+	}
+	return postJSON(ctx, s.hooks.client, to, body, headers, secret)
+}
+
+// postJSON sends body and treats any 2xx as delivered, redirects are not followed. When secret is set
+// body is signed with HMAC-SHA256 of "timestamp.body" in X-Signature header
+func postJSON(ctx context.Context, client *http.Client, to string, body []byte, headers map[string]string, secret string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, to, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "ton-provider-web")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	if secret != "" {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set("X-Timestamp", ts)
+		req.Header.Set("X-Signature", "sha256="+signPayload(secret, ts, body))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// url is not logged, it may contain bot token
+		var ue *url.Error
+		if errors.As(err, &ue) {
+			err = ue.Err
+		}
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected response status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func signPayload(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func alertText(a *ExpiryAlert) string {
+	if a.Event == NotifyTest {
+		return "Test notification, alerts about expiring files will come here."
+	}
+	return fmt.Sprintf("File %s will expire in %s, on %s.\nContract %s balance is %s TON, it costs %s TON per day. Top up the contract to keep the file stored.",
+		a.FileName, a.TimeLeft, a.ExpireAt.UTC().Format("2006-01-02 15:04 UTC"), a.ContractAddr, a.Balance, a.PerDay)
+}
+
+func validateWebhookURL(v string) error {
+	if len(v) > 2000 {
+		return fmt.Errorf("%w: webhook url is too long", ErrInvalidInput)
+	}
+
+	u, err := url.Parse(v)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("%w: webhook url should be http or https url", ErrInvalidInput)
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var errAddressNotAllowed = errors.New("address is not allowed")
+
+// blockedNetworks are special-purpose ranges which are not covered by net.IP checks
+var blockedNetworks = mustParseCIDRs(
+	"0.0.0.0/8",      // this network
+	"100.64.0.0/10",  // carrier-grade nat
+	"192.0.0.0/24",   // protocol assignments
+	"198.18.0.0/15",  // benchmarking
+	"240.0.0.0/4",    // reserved
+	"64:ff9b::/96",   // nat64, maps to any ipv4
+	"64:ff9b:1::/48", // local-use nat64
+	"2002::/16",      // 6to4, maps to any ipv4
+	"2001::/32",      // teredo
+	"fec0::/10",      // deprecated site-local
+)
+
+// webhookGuard keeps user-provided webhooks away from internal network. Url is checked on registration
+// and before every delivery, and every connection is checked once more in the dialer, after dns resolution,
+// so rebinding of the name to internal address does not help
+type webhookGuard struct {
+	// devMode allows http and local addresses, to test delivery with a local stub
+	devMode bool
+	// denied are ip:port of internal services, like storage daemon api, they are denied even in dev mode
+	denied []string
+	client *http.Client
+}
+
+func newWebhookGuard(devMode bool, deniedHosts []string, logger zerolog.Logger) *webhookGuard {
+	g := &webhookGuard{devMode: devMode}
+	for _, h := range deniedHosts {
+		addrs, err := resolveHostPort(h)
+		if err != nil {
+			logger.Warn().Err(err).Str("host", h).Msg("failed to resolve host denied for webhooks")
+			continue
+		}
+		g.denied = append(g.denied, addrs...)
+	}
+
+	dialer := &net.Dialer{
+		Timeout: notifyTimeout,
+		Control: g.control,
+	}
+	g.client = &http.Client{
+		Transport: &http.Transport{
+			// no proxy, it would be the only address checked by dialer
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: notifyTimeout,
+			MaxIdleConnsPerHost: 2,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: noRedirect,
+	}
+	return g
+}
+
+// checkURL validates webhook url and resolves its host, every resolved address should be allowed
+func (g *webhookGuard) checkURL(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" {
+		return fmt.Errorf("%w: invalid webhook url", ErrInvalidInput)
+	}
+
+	port := u.Port()
+	switch {
+	case u.Scheme == "https":
+		if port == "" {
+			port = "443"
+		}
+	case u.Scheme == "http" && g.devMode:
+		if port == "" {
+			port = "80"
+		}
+	default:
+		return fmt.Errorf("%w: webhook url should be https url", ErrInvalidInput)
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("%w: failed to resolve webhook host", ErrInvalidInput)
+	}
+
+	for _, a := range addrs {
+		if err = g.checkIP(a.IP, port); err != nil {
+			return fmt.Errorf("%w: webhook host resolves to internal address", ErrInvalidInput)
+		}
+	}
+	return nil
+}
+
+// control is called by dialer with already resolved address, right before connection
+func (g *webhookGuard) control(_, address string, _ syscall.RawConn) error {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return errAddressNotAllowed
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return errAddressNotAllowed
+	}
+	return g.checkIP(ip, port)
+}
+
+func (g *webhookGuard) checkIP(ip net.IP, port string) error {
+	if v4 := ip.To4(); v4 != nil {
+		ip = v4
+	}
+
+	if slices.Contains(g.denied, net.JoinHostPort(ip.String(), port)) {
+		return errAddressNotAllowed
+	}
+	if g.devMode {
+		return nil
+	}
+
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return errAddressNotAllowed
+	}
+	for _, network := range blockedNetworks {
+		if network.Contains(ip) {
+			return errAddressNotAllowed
+		}
+	}
+	return nil
+}
+
+// resolveHostPort returns ip:port list of url or host:port, port of url is taken from scheme when not set
+func resolveHostPort(v string) ([]string, error) {
+	var host, port string
+	if strings.Contains(v, "://") {
+		u, err := url.Parse(v)
+		if err != nil {
+			return nil, err
+		}
+
+		host, port = u.Hostname(), u.Port()
+		if port == "" {
+			port = "80"
+			if u.Scheme == "https" {
+				port = "443"
+			}
+		}
+	} else {
+		var err error
+		if host, port, err = net.SplitHostPort(v); err != nil {
+			return nil, err
+		}
+	}
+
+	ips, err := net.LookupIP(host)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		if v4 := ip.To4(); v4 != nil {
+			ip = v4
+		}
+		list = append(list, net.JoinHostPort(ip.String(), port))
+	}
+	return list, nil
+}
+
+// noRedirect makes client return redirect response as is, so webhook cannot forward us to another host
+func noRedirect(*http.Request, []*http.Request) error {
+	return http.ErrUseLastResponse
+}
+
+func mustParseCIDRs(list ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(list))
+	for _, c := range list {
+		_, network, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
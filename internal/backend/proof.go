@@ -0,0 +1,58 @@
+package backend
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const proofPayloadTTL = 5 * time.Minute
+
+var ErrProofPayloadInvalid = errors.New("invalid proof payload")
+
+func (s *Service) UseProofPayload(nonce string, expireAt time.Time) (bool, error) {
+	return s.db.UseProofPayload(nonce, expireAt)
+}
+
+// newProofPayload generates random challenge for TON Connect proof,
+// format is hex of nonce(16) + expire unix(8) + mac(16)
+func (s *Server) newProofPayload() (string, error) {
+	data := make([]byte, 24, 40)
+	if _, err := rand.Read(data[:16]); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	binary.BigEndian.PutUint64(data[16:], uint64(time.Now().Add(proofPayloadTTL).Unix()))
+
+	return hex.EncodeToString(append(data, s.proofPayloadMAC(data)...)), nil
+}
+
+// parseProofPayload verifies mac and expiration of payload issued by newProofPayload
+func (s *Server) parseProofPayload(payload string) (nonce string, expireAt time.Time, err error) {
+	data, err := hex.DecodeString(payload)
+	if err != nil || len(data) != 40 {
+		return "", time.Time{}, fmt.Errorf("%w: bad format", ErrProofPayloadInvalid)
+	}
+
+	if !hmac.Equal(s.proofPayloadMAC(data[:24]), data[24:]) {
+		return "", time.Time{}, fmt.Errorf("%w: bad signature", ErrProofPayloadInvalid)
+	}
+
+	expireAt = time.Unix(int64(binary.BigEndian.Uint64(data[16:24])), 0)
+	if time.Now().After(expireAt) {
+		return "", time.Time{}, fmt.Errorf("%w: expired", ErrProofPayloadInvalid)
+	}
+
+	return hex.EncodeToString(data[:16]), expireAt, nil
+}
+
+func (s *Server) proofPayloadMAC(data []byte) []byte {
+	mac := hmac.New(sha256.New, s.key.Seed())
+	mac.Write([]byte("ton-proof-payload"))
+	mac.Write(data)
+	return mac.Sum(nil)[:16]
+}
@@ -0,0 +1,315 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/xssnick/ton-provider-web/internal/backend/db"
+	"github.com/xssnick/tonutils-go/tlb"
+	"github.com/xssnick/tonutils-storage-provider/pkg/transport"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	providerPollInterval   = 10 * time.Minute
+	providerPollTimeout    = 10 * time.Second
+	providerRatesRetention = 7 * 24 * time.Hour
+	// providerUptimeWindow is the period of polls which reachability is reported as uptime
+	providerUptimeWindow = 24 * time.Hour
+)
+
+var ErrProviderNotFound = errors.New("provider not found")
+
+// ProviderOffer is the last known offer of the provider for the bag size
+type ProviderOffer struct {
+	Key      string `json:"key"`
+	Name     string `json:"name"`
+	Disabled bool   `json:"disabled,omitempty"`
+
+	Reachable bool `json:"reachable"`
+	Available bool `json:"available"`
+	// Fits is true when provider is reachable, accepts bags and has enough space for the size
+	Fits bool `json:"fits"`
+	// Uptime is a share of successful polls during the last day
+	Uptime float64 `json:"uptime"`
+
+	RatePerMBDay     string `json:"rate_per_mb_day"`
+	MinBounty        string `json:"min_bounty"`
+	MinSpanSec       uint32 `json:"min_span_sec"`
+	MaxSpanSec       uint32 `json:"max_span_sec"`
+	SpaceAvailableMB uint64 `json:"space_available_mb"`
+
+	PerDay        string `json:"per_day,omitempty"`
+	PerProof      string `json:"per_proof,omitempty"`
+	ProofEvery    string `json:"proof_every,omitempty"`
+	ProofEverySec uint32 `json:"proof_every_sec,omitempty"`
+
+	CheckedAt *time.Time `json:"checked_at"`
+}
+
+// RankProviders returns offers of enabled providers for the size, fitting offers go first from the cheapest,
+// disabled providers are included only for admin
+func (s *Service) RankProviders(size uint64, withDisabled bool) ([]ProviderOffer, error) {
+	providers, err := s.db.GetProviders()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve providers: %w", err)
+	}
+
+	type rankedOffer struct {
+		offer  ProviderOffer
+		perDay *big.Int
+	}
+
+	// size in megabytes rounded up, provider space is compared in megabytes to not overflow on shift
+	sizeMB := size >> 20
+	if size&(1<<20-1) != 0 {
+		sizeMB++
+	}
+
+	var ranked []rankedOffer
+	for _, p := range providers {
+		if p.Disabled && !withDisabled {
+			continue
+		}
+
+		offer := ProviderOffer{
+			Key:      strings.ToUpper(hex.EncodeToString(p.Key)),
+			Name:     p.Name,
+			Disabled: p.Disabled,
+		}
+
+		history, err := s.db.GetProviderRates(p.Key, time.Now().Add(-providerUptimeWindow))
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve provider rates: %w", err)
+		}
+
+		var reachable int
+		for _, r := range history {
+			if r.Reachable {
+				reachable++
+			}
+		}
+		if len(history) > 0 {
+			offer.Uptime = float64(reachable) / float64(len(history))
+		}
+
+		last, err := s.db.GetLastProviderRates(p.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve provider rates: %w", err)
+		}
+
+		r := rankedOffer{offer: offer}
+		if last != nil {
+			r.offer.CheckedAt = &last.CheckedAt
+			r.offer.Reachable = last.Reachable
+		}
+
+		if last != nil && last.Reachable {
+			r.offer.Available = last.Available
+			r.offer.RatePerMBDay = tlb.FromNanoTON(new(big.Int).SetBytes(last.RatePerMBDay)).String()
+			r.offer.MinBounty = tlb.FromNanoTON(new(big.Int).SetBytes(last.MinBounty)).String()
+			r.offer.MinSpanSec = last.MinSpan
+			r.offer.MaxSpanSec = last.MaxSpan
+			r.offer.SpaceAvailableMB = last.SpaceAvailableMB
+
+			if !p.Disabled && last.Available && last.SpaceAvailableMB >= sizeMB {
+				off := calculateOffer(toStorageRates(last), size)
+
+				r.offer.Fits = true
+				r.offer.PerDay = tlb.FromNanoTON(off.PerDayNano).String()
+				r.offer.PerProof = tlb.FromNanoTON(off.PerProofNano).String()
+				r.offer.ProofEvery = off.Every
+				r.offer.ProofEverySec = off.Span
+				r.perDay = off.PerDayNano
+			}
+		}
+		ranked = append(ranked, r)
+	}
+
+	sort.SliceStable(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if a.offer.Fits != b.offer.Fits {
+			return a.offer.Fits
+		}
+		if a.offer.Fits {
+			return a.perDay.Cmp(b.perDay) < 0
+		}
+		return a.offer.Uptime > b.offer.Uptime
+	})
+
+	list := make([]ProviderOffer, 0, len(ranked))
+	for _, r := range ranked {
+		list = append(list, r.offer)
+	}
+	return list, nil
+}
+
+// AddProvider registers provider or enables it again, when it was disabled
+func (s *Service) AddProvider(key []byte, name, addedBy string) error {
+	if len(key) != 32 {
+		return fmt.Errorf("%w: provider key must be 32 bytes long", ErrInvalidInput)
+	}
+	if len(name) > 100 {
+		return fmt.Errorf("%w: provider name is too long", ErrInvalidInput)
+	}
+
+	p, err := s.db.GetProvider(key)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve provider: %w", err)
+	}
+	if p == nil {
+		p = &db.StorageProvider{Key: key, AddedBy: addedBy, CreatedAt: time.Now()}
+	}
+	if name != "" {
+		p.Name = name
+	}
+	p.Disabled = false
+
+	if err = s.db.AddProvider(*p); err != nil {
+		return fmt.Errorf("failed to store provider: %w", err)
+	}
+
+	// poll on the next cycle, to have its offer as soon as possible
+	s.providersPolledAt.Store(0)
+	return nil
+}
+
+// DisableProvider stops offering provider for new contracts
+func (s *Service) DisableProvider(key []byte) error {
+	p, err := s.db.GetProvider(key)
+	if err != nil {
+		return fmt.Errorf("failed to retrieve provider: %w", err)
+	}
+	if p == nil {
+		return ErrProviderNotFound
+	}
+
+	p.Disabled = true
+	if err = s.db.AddProvider(*p); err != nil {
+		return fmt.Errorf("failed to store provider: %w", err)
+	}
+	return nil
+}
+
+// providerKeys returns keys of all registered providers, including disabled, contracts with them are still tracked
+func (s *Service) providerKeys() ([][]byte, error) {
+	providers, err := s.db.GetProviders()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve providers: %w", err)
+	}
+
+	keys := make([][]byte, 0, len(providers))
+	for _, p := range providers {
+		keys = append(keys, p.Key)
+	}
+	return keys, nil
+}
+
+// offerProviderKeys returns keys of providers for new contracts, which are enabled and were reachable on the last poll
+func (s *Service) offerProviderKeys() ([][]byte, error) {
+	providers, err := s.db.GetProviders()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve providers: %w", err)
+	}
+
+	var keys [][]byte
+	for _, p := range providers {
+		if p.Disabled {
+			continue
+		}
+
+		last, err := s.db.GetLastProviderRates(p.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to retrieve provider rates: %w", err)
+		}
+		if last != nil && !last.Reachable {
+			continue
+		}
+		keys = append(keys, p.Key)
+	}
+	return keys, nil
+}
+
+// MaxReplicas returns number of providers which can be chosen for a new contract
+func (s *Service) MaxReplicas() (int, error) {
+	keys, err := s.offerProviderKeys()
+	if err != nil {
+		return 0, err
+	}
+	return len(keys), nil
+}
+
+// doPollProviders records rates and reachability of every provider, once in providerPollInterval
+func (s *Service) doPollProviders() {
+	if time.Since(time.Unix(s.providersPolledAt.Load(), 0)) < providerPollInterval {
+		return
+	}
+	s.providersPolledAt.Store(time.Now().Unix())
+
+	defer observeCycle("providers", time.Now())
+
+	providers, err := s.db.GetProviders()
+	if err != nil {
+		s.logger.Error().Err(err).Msg("failed to get providers")
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, p := range providers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), providerPollTimeout)
+			defer cancel()
+
+			rates := db.ProviderRates{Key: p.Key, CheckedAt: time.Now()}
+
+			sr, err := s.provider.GetStorageRates(ctx, p.Key, 1<<20)
+			if err != nil {
+				chainFailures.WithLabelValues("get_storage_rates").Inc()
+				s.logger.Debug().Err(err).Hex("provider", p.Key).Msg("provider is not reachable")
+				rates.Error = err.Error()
+			} else {
+				rates.Reachable = true
+				rates.Available = sr.Available
+				rates.RatePerMBDay = sr.RatePerMBDay
+				rates.MinBounty = sr.MinBounty
+				rates.SpaceAvailableMB = sr.SpaceAvailableMB
+				rates.MinSpan = sr.MinSpan
+				rates.MaxSpan = sr.MaxSpan
+			}
+
+			if err = s.db.AddProviderRates(rates, providerRatesRetention); err != nil {
+				s.logger.Error().Err(err).Hex("provider", p.Key).Msg("failed to store provider rates")
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func toStorageRates(r *db.ProviderRates) *transport.StorageRatesResponse {
+	return &transport.StorageRatesResponse{
+		Available:        r.Available,
+		RatePerMBDay:     r.RatePerMBDay,
+		MinBounty:        r.MinBounty,
+		SpaceAvailableMB: r.SpaceAvailableMB,
+		MinSpan:          r.MinSpan,
+		MaxSpan:          r.MaxSpan,
+	}
+}
+
+func containsKey(keys [][]byte, key []byte) bool {
+	for _, k := range keys {
+		if bytes.Equal(k, key) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,193 @@
+package backend
+
+import (
+	"errors"
+	"fmt"
+	"github.com/xssnick/ton-provider-web/internal/backend/db"
+	"io/fs"
+	"math"
+	"path/filepath"
+)
+
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+type Usage struct {
+	Bytes   uint64 `json:"bytes"`
+	Files   uint64 `json:"files"`
+	Pending uint64 `json:"pending"`
+}
+
+type UserQuota struct {
+	Address    string  `json:"address"`
+	CustomPlan bool    `json:"custom_plan"`
+	Plan       db.Plan `json:"plan"`
+	Usage      Usage   `json:"usage"`
+}
+
+// GetUserPlan returns plan override merged with the default plan, zero limit means unlimited
+func (s *Service) GetUserPlan(userAddr string) (db.Plan, bool, error) {
+	plan := s.defaultPlan
+
+	custom, err := s.db.GetUserPlan(userAddr)
+	if err != nil {
+		return plan, false, fmt.Errorf("failed to get user plan: %w", err)
+	}
+	if custom == nil {
+		return plan, false, nil
+	}
+
+	if custom.MaxBytes != nil {
+		plan.MaxBytes = *custom.MaxBytes
+	}
+	if custom.MaxFiles != nil {
+		plan.MaxFiles = *custom.MaxFiles
+	}
+	if custom.MaxPending != nil {
+		plan.MaxPending = *custom.MaxPending
+	}
+	if custom.MaxUploadSize != nil {
+		plan.MaxUploadSize = *custom.MaxUploadSize
+	}
+	return plan, true, nil
+}
+
+// SetUserPlan stores override set by admin, it is kept when config overrides are synced on start
+func (s *Service) SetUserPlan(userAddr string, plan db.PlanOverride) error {
+	plan.Source = db.PlanSourceAdmin
+	return s.db.SetUserPlan(userAddr, plan)
+}
+
+func (s *Service) DeleteUserPlan(userAddr string) error {
+	return s.db.DeleteUserPlan(userAddr)
+}
+
+// GetQuota returns user's limits and current usage
+func (s *Service) GetQuota(userAddr string) (*UserQuota, error) {
+	plan, custom, err := s.GetUserPlan(userAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	usage, err := s.getUsage(userAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UserQuota{
+		Address:    userAddr,
+		CustomPlan: custom,
+		Plan:       plan,
+		Usage:      *usage,
+	}, nil
+}
+
+// getUsage counts files and bytes held locally, including not completed uploads, from stored sizes without reading disk
+func (s *Service) getUsage(userAddr string) (*Usage, error) {
+	files, err := s.db.GetFilesByUser(userAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve files for user %s: %w", userAddr, err)
+	}
+
+	uploads, err := s.db.GetUploadsByUser(userAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve uploads for user %s: %w", userAddr, err)
+	}
+
+	usage := &Usage{
+		Files:   uint64(len(files) + len(uploads)),
+		Pending: uint64(len(uploads)),
+	}
+
+	for _, upload := range uploads {
+		usage.Bytes += upload.Size
+	}
+
+	for _, file := range files {
+		if file.Provider == nil || file.Provider.Status == "error" {
+			usage.Pending++
+		}
+
+		if file.Bag != nil {
+			usage.Bytes += file.Bag.FullSize
+		} else {
+			usage.Bytes += file.Size
+		}
+	}
+	return usage, nil
+}
+
+// checkQuota verifies that user can add one more file of the given size
+func (s *Service) checkQuota(userAddr string, size uint64) error {
+	banned, err := s.db.IsBanned(userAddr)
+	if err != nil {
+		return err
+	}
+	if banned {
+		return ErrUserBanned
+	}
+
+	plan, _, err := s.GetUserPlan(userAddr)
+	if err != nil {
+		return err
+	}
+
+	usage, err := s.getUsage(userAddr)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case plan.MaxPending > 0 && usage.Pending >= plan.MaxPending:
+		return fmt.Errorf("%w: too many pending files", ErrQuotaExceeded)
+	case plan.MaxFiles > 0 && usage.Files >= plan.MaxFiles:
+		return fmt.Errorf("%w: too many files", ErrQuotaExceeded)
+	case plan.MaxUploadSize > 0 && size > plan.MaxUploadSize:
+		return fmt.Errorf("%w: file is too big", ErrQuotaExceeded)
+	case plan.MaxBytes > 0 && usage.Bytes+size > plan.MaxBytes:
+		return fmt.Errorf("%w: not enough space", ErrQuotaExceeded)
+	}
+	return nil
+}
+
+// uploadLimit returns max size of the next upload, when size is not known in advance
+func (s *Service) uploadLimit(userAddr string) (uint64, error) {
+	plan, _, err := s.GetUserPlan(userAddr)
+	if err != nil {
+		return 0, err
+	}
+
+	limit := uint64(math.MaxUint64)
+	if plan.MaxUploadSize > 0 {
+		limit = plan.MaxUploadSize
+	}
+
+	if plan.MaxBytes > 0 {
+		usage, err := s.getUsage(userAddr)
+		if err != nil {
+			return 0, err
+		}
+
+		left := uint64(0)
+		if plan.MaxBytes > usage.Bytes {
+			left = plan.MaxBytes - usage.Bytes
+		}
+		limit = min(limit, left)
+	}
+	return limit, nil
+}
+
+func diskSize(path string) uint64 {
+	var sz uint64
+	_ = filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				sz += uint64(info.Size())
+			}
+		}
+		return nil
+	})
+	return sz
+}
@@ -0,0 +1,207 @@
+package backend
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"github.com/xssnick/ton-provider-web/internal/backend/db"
+	"github.com/xssnick/tonutils-go/address"
+	"github.com/xssnick/tonutils-go/tlb"
+	"math/big"
+	"strings"
+	"time"
+)
+
+const maxQuoteDays = 3650
+
+type QuoteParams struct {
+	// FileName is a user's file which bag size is used, for stored file quote is for topup
+	FileName string
+	// Size is used when there is no file yet
+	Size     uint64
+	Days     uint32
+	Replicas int
+}
+
+// StorageQuote is the exact amount to send to have the bag stored by every provider for the requested days
+type StorageQuote struct {
+	Size       uint64 `json:"size"`
+	Days       uint32 `json:"days"`
+	Amount     string `json:"amount"`
+	AmountNano string `json:"amount_nano"`
+	// Balance is what contract already has, it is deducted from the amount
+	Balance string `json:"balance,omitempty"`
+	PerDay  string `json:"per_day"`
+	// ExpireAt is projected the same way as time left of stored files
+	ExpireAt  time.Time       `json:"expire_at"`
+	TimeLeft  string          `json:"time_left"`
+	Providers []ProviderQuote `json:"providers"`
+}
+
+type ProviderQuote struct {
+	Key           string `json:"key"`
+	Amount        string `json:"amount"`
+	PerDay        string `json:"per_day"`
+	PerProof      string `json:"per_proof"`
+	ProofEverySec uint32 `json:"proof_every_sec"`
+	Proofs        uint64 `json:"proofs"`
+}
+
+// quoteProvider is a provider with its rate in the contract, or in the offer for a new one
+type quoteProvider struct {
+	Key         []byte
+	RatePerMB   *big.Int
+	Span        uint32
+	LastProofAt time.Time
+}
+
+// GetQuote calculates price of storage for the requested days, for a new contract or for topup of the stored file
+func (s *Service) GetQuote(ctx context.Context, userAddr string, params QuoteParams) (*StorageQuote, error) {
+	if params.Days == 0 {
+		return nil, fmt.Errorf("%w: days are required", ErrInvalidInput)
+	}
+	if err := checkQuoteDays(params.Days); err != nil {
+		return nil, err
+	}
+
+	if params.FileName == "" {
+		if params.Size == 0 {
+			return nil, fmt.Errorf("%w: file name or size is required", ErrInvalidInput)
+		}
+		return s.deployQuote(ctx, params.Size, params.Days, params.Replicas)
+	}
+
+	fi, err := s.db.GetFile(userAddr, params.FileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+	if fi == nil {
+		return nil, ErrFileNotFound
+	}
+
+	switch fi.State {
+	case db.FileStateBag:
+		return s.deployQuote(ctx, fi.Bag.FullSize, params.Days, params.Replicas)
+	case db.FileStateStored:
+		return s.topupQuote(ctx, fi, params.Days)
+	default:
+		return nil, ErrBagNotReady
+	}
+}
+
+func (s *Service) deployQuote(ctx context.Context, size uint64, days uint32, replicas int) (*StorageQuote, error) {
+	if replicas == 0 {
+		replicas = 1
+	}
+
+	offers, err := s.getProviderOffers(ctx, size)
+	if err != nil {
+		return nil, err
+	}
+	if len(offers) < replicas {
+		return nil, fmt.Errorf("%w: %d of %d are available", ErrNotEnoughProviders, len(offers), replicas)
+	}
+
+	return buildQuote(offersToQuote(offers[:replicas]), size, days, new(big.Int)), nil
+}
+
+func (s *Service) topupQuote(ctx context.Context, fi *db.FileInfo, days uint32) (*StorageQuote, error) {
+	balance, providers, err := s.fetchContractInfo(ctx, fi.Bag, address.MustParseAddr(fi.OwnerAddr))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get contract info: %w", err)
+	}
+
+	list := make([]quoteProvider, 0, len(providers))
+	for _, p := range providers {
+		list = append(list, quoteProvider{
+			Key:         p.Key,
+			RatePerMB:   p.RatePerMB,
+			Span:        p.MaxSpan,
+			LastProofAt: p.LastProofAt,
+		})
+	}
+
+	return buildQuote(list, fi.Bag.FullSize, days, balance.Nano()), nil
+}
+
+func checkQuoteDays(days uint32) error {
+	if days > maxQuoteDays {
+		return fmt.Errorf("%w: days should be not more than %d", ErrInvalidInput, maxQuoteDays)
+	}
+	return nil
+}
+
+func offersToQuote(offers []providerOffer) []quoteProvider {
+	now := time.Now()
+
+	list := make([]quoteProvider, 0, len(offers))
+	for _, o := range offers {
+		list = append(list, quoteProvider{
+			Key:         o.Key,
+			RatePerMB:   o.Offer.RatePerMBNano,
+			Span:        o.Offer.Span,
+			LastProofAt: now,
+		})
+	}
+	return list
+}
+
+// buildQuote calculates amount for every provider to be paid for all proofs during the days,
+// balance which contract already has is deducted
+func buildQuote(providers []quoteProvider, size uint64, days uint32, balance *big.Int) *StorageQuote {
+	szMB := bagSizeMB(size)
+	duration := uint64(days) * 86400
+
+	quote := &StorageQuote{
+		Size: size,
+		Days: days,
+	}
+
+	need := new(big.Int)
+	total := new(big.Int)
+	perDay := make([]*big.Int, len(providers))
+	for i, p := range providers {
+		perSpan := pricePerSpan(p.RatePerMB, szMB, p.Span)
+		perDay[i] = pricePerDay(p.RatePerMB, szMB)
+		total.Add(total, perDay[i])
+
+		var proofs uint64
+		if p.Span > 0 {
+			proofs = (duration + uint64(p.Span) - 1) / uint64(p.Span)
+		}
+
+		amount := new(big.Int).Mul(perSpan, new(big.Int).SetUint64(proofs))
+		need.Add(need, amount)
+
+		quote.Providers = append(quote.Providers, ProviderQuote{
+			Key:           strings.ToUpper(hex.EncodeToString(p.Key)),
+			Amount:        tlb.FromNanoTON(amount).String(),
+			PerDay:        tlb.FromNanoTON(perDay[i]).String(),
+			PerProof:      tlb.FromNanoTON(perSpan).String(),
+			ProofEverySec: p.Span,
+			Proofs:        proofs,
+		})
+	}
+
+	amount := new(big.Int).Sub(need, balance)
+	if amount.Sign() < 0 {
+		amount.SetInt64(0)
+	}
+
+	quote.Amount = tlb.FromNanoTON(amount).String()
+	quote.AmountNano = amount.String()
+	quote.PerDay = tlb.FromNanoTON(total).String()
+	if balance.Sign() > 0 {
+		quote.Balance = tlb.FromNanoTON(balance).String()
+	}
+
+	// the one which runs out first defines expiration, as for stored files
+	shares := shareBalance(new(big.Int).Add(balance, amount), perDay)
+	for i, p := range providers {
+		left, expireAt := daysLeft(shares[i], p.RatePerMB, szMB, p.Span, p.LastProofAt)
+		if i == 0 || expireAt.Before(quote.ExpireAt) {
+			quote.ExpireAt, quote.TimeLeft = expireAt, left
+		}
+	}
+	return quote
+}
@@ -0,0 +1,106 @@
+package backend
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/rs/zerolog"
+	"net/http"
+	"time"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+type requestInfoKey struct{}
+
+// requestInfo is filled by middlewares while request goes through them, and reported in access log
+type requestInfo struct {
+	ID string
+	IP string
+	// Route is the registered pattern, used as metric label instead of the raw path
+	Route string
+	Addr  string
+	// Auth is the way request was authorized: session, token or admin-key
+	Auth string
+}
+
+// requestHandler assigns request id, passes logger with it down in the context and writes access log
+func (s *Server) requestHandler(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+
+		info := &requestInfo{
+			ID:    r.Header.Get(requestIDHeader),
+			IP:    s.clientIP(r),
+			Route: route,
+		}
+		if !validRequestID(info.ID) {
+			info.ID = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, info.ID)
+
+		logger := s.logger.With().Str("request_id", info.ID).Logger()
+		ctx := context.WithValue(logger.WithContext(r.Context()), requestInfoKey{}, info)
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(rec, r.WithContext(ctx))
+
+		logger.Info().
+			Str("method", r.Method).
+			Str("route", route).
+			Str("path", r.URL.Path).
+			Int("status", rec.status).
+			Dur("latency", time.Since(started)).
+			Str("ip", info.IP).
+			Str("addr", info.Addr).
+			Str("auth", info.Auth).
+			Msg("request")
+	}
+}
+
+// log returns logger of the request, with its id
+func (s *Server) log(r *http.Request) *zerolog.Logger {
+	return ctxLogger(r.Context(), &s.logger)
+}
+
+// ctxLogger returns logger from context when it is there, or the fallback
+func ctxLogger(ctx context.Context, fallback *zerolog.Logger) *zerolog.Logger {
+	if l := zerolog.Ctx(ctx); l.GetLevel() != zerolog.Disabled {
+		return l
+	}
+	return fallback
+}
+
+func getRequestInfo(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*requestInfo)
+	if info == nil {
+		return &requestInfo{}
+	}
+	return info
+}
+
+// setRequestUser records authorized wallet of the request for access log and audit
+func setRequestUser(r *http.Request, addr, auth string) {
+	info := getRequestInfo(r.Context())
+	info.Addr = addr
+	info.Auth = auth
+}
+
+func newRequestID() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID allows to reuse id from proxy, when it is safe to be logged
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
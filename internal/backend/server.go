@@ -1,38 +1,115 @@
 package backend
 
 import (
+	"context"
 	"crypto/ed25519"
+	"crypto/subtle"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"
 	"github.com/sethvargo/go-limiter"
 	"github.com/sethvargo/go-limiter/memorystore"
+	"github.com/xssnick/ton-provider-web/internal/backend/db"
 	"github.com/xssnick/tonutils-go/address"
 	"github.com/xssnick/tonutils-go/ton/wallet"
+	"io"
+	"mime"
 	"net/http"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
 
+// ServerConfig is the api server settings
+type ServerConfig struct {
+	// Key signs session tokens
+	Key         ed25519.PrivateKey
+	Addr        string
+	Origins     []string
+	MaxFileSize uint64
+	SessionTTL  time.Duration
+	FrontendDir string
+
+	// Admins are wallets allowed to use admin api after regular login, AdminKey is an alternative static key
+	Admins   []string
+	AdminKey string
+
+	// TrustedProxies are networks of proxies which client address is taken from ProxyHeader for
+	TrustedProxies    []string
+	ProxyHeader       string
+	RateLimitByWallet bool
+
+	// MetricsAddr serves prometheus metrics on a separate, usually internal, address,
+	// when it is empty metrics are served on the api address for admins only
+	MetricsAddr string
+}
+
 type Server struct {
-	domain    string
-	maxFileSz uint64
-	svc       *Service
-	key       ed25519.PrivateKey
-	logger    zerolog.Logger
-	prf       *wallet.TonConnectVerifier
+	origins    *allowedOrigins
+	maxFileSz  uint64
+	sessionTTL time.Duration
+	svc        *Service
+	key        ed25519.PrivateKey
+	logger     zerolog.Logger
+	// verifiers are TON Connect proof verifiers by lowercase domain
+	verifiers map[string]*wallet.TonConnectVerifier
+	web       *webApp
+
+	// admins are normalized wallet addresses allowed to use admin api
+	admins   map[string]bool
+	adminKey string
+
+	proxies trustedProxies
+	// proxyHeader is the only header with client address which trusted proxies set
+	proxyHeader string
+	// rateLimitByWallet keys limits of authorized requests by wallet instead of ip
+	rateLimitByWallet bool
+
+	// closed when shutdown begins, to release long-lived connections
+	closing chan struct{}
 }
 
-func Listen(key ed25519.PrivateKey, addr, domain string, maxFileSz uint64, svc *Service, prf *wallet.TonConnectVerifier, logger zerolog.Logger) error {
+// Listen serves api until ctx is canceled, then drains active requests and returns
+func Listen(ctx context.Context, cfg ServerConfig, svc *Service, verifiers map[string]*wallet.TonConnectVerifier, logger zerolog.Logger) error {
 	s := &Server{
-		domain:    domain,
-		key:       key,
-		logger:    logger,
-		maxFileSz: maxFileSz,
-		svc:       svc,
-		prf:       prf,
+		admins:            map[string]bool{},
+		adminKey:          cfg.AdminKey,
+		origins:           newAllowedOrigins(cfg.Origins),
+		key:               cfg.Key,
+		logger:            logger,
+		maxFileSz:         cfg.MaxFileSize,
+		sessionTTL:        cfg.SessionTTL,
+		svc:               svc,
+		verifiers:         map[string]*wallet.TonConnectVerifier{},
+		web:               newWebApp(cfg.FrontendDir),
+		rateLimitByWallet: cfg.RateLimitByWallet,
+		closing:           make(chan struct{}),
+	}
+
+	var err error
+	if s.proxies, err = newTrustedProxies(cfg.TrustedProxies); err != nil {
+		return fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+	if s.proxyHeader, err = proxyHeaderName(cfg.ProxyHeader); err != nil {
+		return err
+	}
+
+	for domain, verifier := range verifiers {
+		s.verifiers[strings.ToLower(domain)] = verifier
+	}
+
+	for _, a := range cfg.Admins {
+		admin, err := NormalizeAddress(a)
+		if err != nil {
+			return fmt.Errorf("invalid admin address %s: %w", a, err)
+		}
+		s.admins[admin] = true
 	}
 
 	rateLimit, err := memorystore.New(&memorystore.Config{
@@ -51,27 +128,136 @@ func Listen(key ed25519.PrivateKey, addr, domain string, maxFileSz uint64, svc *
 		return fmt.Errorf("failed to create memory store files limit: %w", err)
 	}
 
-	http.HandleFunc("/api/v1/login/data", s.getSignDataHandler)
-	http.HandleFunc("/api/v1/provider", s.getProviderIdHandler)
-	http.HandleFunc("/api/v1/login", s.securityHandler(s.loginHandler, rateLimit))
+	rateLimitPublic, err := memorystore.New(&memorystore.Config{
+		Tokens:   10,
+		Interval: 1 * time.Minute,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create memory store public limit: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	handle := func(route string, h http.HandlerFunc) {
+		mux.HandleFunc(route, metricsHandler(route, s.requestHandler(route, h)))
+	}
+
+	var metricsSrv *http.Server
+	if cfg.MetricsAddr != "" {
+		metricsSrv = &http.Server{
+			Addr:              cfg.MetricsAddr,
+			Handler:           promhttp.Handler(),
+			ReadHeaderTimeout: 15 * time.Second,
+		}
+	} else {
+		handle("/metrics", s.securityHandler(s.adminHandler(s.adminMetricsHandler), rateLimit))
+	}
+
+	handle("/healthz", s.healthHandler)
+	handle("/readyz", s.readyHandler)
+	handle("/api/v1/login/data", s.securityHandler(s.getSignDataHandler, rateLimit))
+	handle("/api/v1/provider", s.securityHandler(s.getProviderIdHandler))
+	handle("/api/v1/providers", s.securityHandler(s.providersHandler, rateLimit))
+	handle("/api/v1/login", s.securityHandler(s.loginHandler, rateLimit))
+	handle("/api/v1/me", s.securityHandler(s.authHandler(ScopeList, s.meHandler), rateLimit))
+	handle("/api/v1/logout", s.securityHandler(s.logoutHandler, rateLimit))
+	handle("/api/v1/logout/all", s.securityHandler(s.authHandler(scopeSessionOnly, s.logoutAllHandler), rateLimit))
+
+	handle("/api/v1/upload", s.securityHandler(s.authHandler(ScopeUpload, s.uploadHandler), rateLimit, rateLimitFiles))
+	handle("/api/v1/upload/folder", s.securityHandler(s.authHandler(ScopeUpload, s.uploadFolderHandler), rateLimit, rateLimitFiles))
+	handle("/api/v1/upload/create", s.securityHandler(s.authHandler(ScopeUpload, s.uploadCreateHandler), rateLimit, rateLimitFiles))
+	handle("/api/v1/import", s.securityHandler(s.authHandler(ScopeUpload, s.importHandler), rateLimit, rateLimitFiles))
+	handle("/api/v1/upload/chunk", s.securityHandler(s.authHandler(ScopeUpload, s.uploadChunkHandler), rateLimit))
+	handle("/api/v1/upload/status", s.securityHandler(s.authHandler(ScopeUpload, s.uploadStatusHandler), rateLimit))
+	handle("/api/v1/upload/cancel", s.securityHandler(s.authHandler(ScopeUpload, s.uploadCancelHandler), rateLimit))
+	handle("/api/v1/list", s.securityHandler(s.authHandler(ScopeList, s.listHandler), rateLimit))
+	handle("/api/v1/events", s.securityHandler(s.authHandler(ScopeList, s.eventsHandler), rateLimit))
+	handle("/api/v1/deploy", s.securityHandler(s.authHandler(ScopeDeployData, s.getDeployDataHandler), rateLimit))
+	handle("/api/v1/withdraw", s.securityHandler(s.authHandler(ScopeDeployData, s.getWithdrawDataHandler), rateLimit))
+	handle("/api/v1/topup", s.securityHandler(s.authHandler(ScopeDeployData, s.getTopupDataHandler), rateLimit))
+	handle("/api/v1/quote", s.securityHandler(s.authHandler(ScopeDeployData, s.quoteHandler), rateLimit))
+	handle("/api/v1/download", s.securityHandler(s.authHandler(scopeSessionOnly, s.downloadHandler), rateLimit))
+	handle("/api/v1/share/create", s.securityHandler(s.authHandler(scopeSessionOnly, s.shareCreateHandler), rateLimit))
+	handle("/api/v1/share/list", s.securityHandler(s.authHandler(scopeSessionOnly, s.shareListHandler), rateLimit))
+	handle("/api/v1/share/revoke", s.securityHandler(s.authHandler(scopeSessionOnly, s.shareRevokeHandler), rateLimit))
+	handle("/api/v1/public/download", s.securityHandler(s.publicDownloadHandler, rateLimitPublic))
+	handle("/api/v1/tokens/create", s.securityHandler(s.authHandler(scopeSessionOnly, s.tokenCreateHandler), rateLimit))
+	handle("/api/v1/tokens/list", s.securityHandler(s.authHandler(scopeSessionOnly, s.tokenListHandler), rateLimit))
+	handle("/api/v1/tokens/revoke", s.securityHandler(s.authHandler(scopeSessionOnly, s.tokenRevokeHandler), rateLimit))
+	handle("/api/v1/audit", s.securityHandler(s.authHandler(scopeSessionOnly, s.auditHandler), rateLimit))
+	handle("/api/v1/notifications", s.securityHandler(s.authHandler(scopeSessionOnly, s.notificationsHandler), rateLimit))
+	handle("/api/v1/notifications/settings", s.securityHandler(s.authHandler(scopeSessionOnly, s.notifySettingsHandler), rateLimit))
+	handle("/api/v1/notifications/test", s.securityHandler(s.authHandler(scopeSessionOnly, s.notifyTestHandler), rateLimit))
+	handle("/api/v1/notifications/telegram", s.securityHandler(s.authHandler(scopeSessionOnly, s.notifyTelegramHandler), rateLimit))
+	handle("/api/v1/webhooks/create", s.securityHandler(s.authHandler(scopeSessionOnly, s.webhookCreateHandler), rateLimit))
+	handle("/api/v1/webhooks/list", s.securityHandler(s.authHandler(scopeSessionOnly, s.webhookListHandler), rateLimit))
+	handle("/api/v1/webhooks/remove", s.securityHandler(s.authHandler(scopeSessionOnly, s.webhookRemoveHandler), rateLimit))
+	handle("/api/v1/webhooks/deliveries", s.securityHandler(s.authHandler(scopeSessionOnly, s.webhookDeliveriesHandler), rateLimit))
+	handle("/api/v1/webhooks/redeliver", s.securityHandler(s.authHandler(scopeSessionOnly, s.webhookRedeliverHandler), rateLimit))
+	handle("/api/v1/remove", s.securityHandler(s.authHandler(ScopeRemove, s.removeHandler), rateLimit))
+
+	handle("/api/v1/admin/users", s.securityHandler(s.adminHandler(s.adminUsersHandler), rateLimit))
+	handle("/api/v1/admin/files", s.securityHandler(s.adminHandler(s.adminFilesHandler), rateLimit))
+	handle("/api/v1/admin/remove", s.securityHandler(s.adminHandler(s.adminRemoveHandler), rateLimit))
+	handle("/api/v1/admin/tasks", s.securityHandler(s.adminHandler(s.adminTasksHandler), rateLimit))
+	handle("/api/v1/admin/tasks/requeue", s.securityHandler(s.adminHandler(s.adminRequeueHandler), rateLimit))
+	handle("/api/v1/admin/bans", s.securityHandler(s.adminHandler(s.adminBansHandler), rateLimit))
+	handle("/api/v1/admin/ban", s.securityHandler(s.adminHandler(s.adminBanHandler), rateLimit))
+	handle("/api/v1/admin/plan", s.securityHandler(s.adminHandler(s.adminPlanHandler), rateLimit))
+	handle("/api/v1/admin/disk", s.securityHandler(s.adminHandler(s.adminDiskHandler), rateLimit))
+	handle("/api/v1/admin/providers", s.securityHandler(s.adminHandler(s.adminProvidersHandler), rateLimit))
+
+	if s.web.available() {
+		handle("/", s.webHandler)
+	} else {
+		logger.Warn().Str("dir", cfg.FrontendDir).Msg("frontend is not built, only api is served")
+	}
+
+	srv := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 15 * time.Second,
+	}
+	srv.RegisterOnShutdown(func() {
+		close(s.closing)
+	})
+
+	shutdownErr := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		logger.Info().Msg("shutting down server")
+
+		shCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if metricsSrv != nil {
+			_ = metricsSrv.Shutdown(shCtx)
+		}
+		shutdownErr <- srv.Shutdown(shCtx)
+	}()
 
-	http.HandleFunc("/api/v1/upload", s.securityHandler(s.authHandler(s.uploadHandler), rateLimit, rateLimitFiles))
-	http.HandleFunc("/api/v1/list", s.securityHandler(s.authHandler(s.listHandler), rateLimit))
-	http.HandleFunc("/api/v1/deploy", s.securityHandler(s.authHandler(s.getDeployDataHandler), rateLimit))
-	http.HandleFunc("/api/v1/withdraw", s.securityHandler(s.authHandler(s.getWithdrawDataHandler), rateLimit))
-	http.HandleFunc("/api/v1/topup", s.securityHandler(s.authHandler(s.getTopupDataHandler), rateLimit))
-	http.HandleFunc("/api/v1/remove", s.securityHandler(s.authHandler(s.removeHandler), rateLimit))
+	if metricsSrv != nil {
+		go func() {
+			logger.Info().Str("addr", cfg.MetricsAddr).Msg("metrics server started")
+			if err := metricsSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Error().Err(err).Msg("metrics server failed")
+			}
+		}()
+	}
 
-	logger.Info().Str("addr", addr).Msg("server started")
-	if err = http.ListenAndServe(addr, nil); err != nil {
+	logger.Info().Str("addr", cfg.Addr).Msg("server started")
+	if err = srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		return err
 	}
+
+	if err = <-shutdownErr; err != nil {
+		return fmt.Errorf("failed to shutdown server: %w", err)
+	}
+	logger.Info().Msg("server stopped")
 	return nil
 }
 
 func (s *Server) loginHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
 		return
 	}
 
@@ -81,61 +267,135 @@ func (s *Server) loginHandler(w http.ResponseWriter, r *http.Request) {
 		StateInit []byte                 `json:"state_init"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		s.logger.Debug().Err(err).Msg("Failed to decode request body")
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		s.log(r).Debug().Err(err).Msg("Failed to decode request body")
+		writeError(w, "Invalid request payload", http.StatusBadRequest)
 		return
 	}
 
 	addr, err := address.ParseRawAddr(body.Address)
 	if err != nil {
-		http.Error(w, "Invalid address", http.StatusBadRequest)
+		writeError(w, "Invalid address", http.StatusBadRequest)
 		return
 	}
 
-	if err := s.prf.VerifyProof(r.Context(), addr, body.Proof, s.signData(), body.StateInit); err != nil {
-		s.logger.Debug().Err(err).Str("addr", addr.String()).Msg("Failed to verify proof")
-		http.Error(w, "Invalid proof", http.StatusBadRequest)
+	nonce, expireAt, err := s.parseProofPayload(body.Proof.Payload)
+	if err != nil {
+		s.log(r).Debug().Err(err).Str("addr", addr.String()).Msg("Failed to verify proof payload")
+		s.writeServiceError(w, r, err, "Invalid proof payload")
 		return
 	}
 
-	// Generate sessionID by signing current time and address string
-	timestamp := time.Now().Unix()
-	sessionData := fmt.Sprintf("%d:%s", timestamp, addr.String())
-	signature := ed25519.Sign(s.key, []byte(sessionData))
-	sessionID := fmt.Sprintf("%x:%s", signature, sessionData)
+	// proof is signed for domain of the page where wallet was connected
+	domain := strings.ToLower(body.Proof.Domain.Value)
+	verifier := s.verifiers[domain]
+	if verifier == nil {
+		s.log(r).Debug().Str("addr", addr.String()).Str("domain", domain).Msg("Proof domain is not allowed")
+		writeError(w, "Proof domain is not allowed", http.StatusBadRequest)
+		return
+	}
 
-	// Create and set the session cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "session",
-		HttpOnly: true,
-		Value:    sessionID,
-		SameSite: http.SameSiteStrictMode,
-	})
+	if err := verifier.VerifyProof(r.Context(), addr, body.Proof, body.Proof.Payload, body.StateInit); err != nil {
+		s.log(r).Debug().Err(err).Str("addr", addr.String()).Msg("Failed to verify proof")
+		writeError(w, "Invalid proof", http.StatusBadRequest)
+		return
+	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]bool{"ok": true})
+	// Payload is accepted only once, to prevent replay of captured proof
+	ok, err := s.svc.UseProofPayload(nonce, expireAt)
+	if err != nil {
+		s.log(r).Error().Err(err).Str("addr", addr.String()).Msg("Failed to mark proof payload as used")
+		writeError(w, "Failed to verify proof", http.StatusInternalServerError)
+		return
+	}
+	if !ok {
+		s.log(r).Debug().Str("addr", addr.String()).Msg("Proof payload already used")
+		s.writeServiceError(w, r, fmt.Errorf("%w: already used", ErrProofPayloadInvalid), "Proof payload already used")
+		return
+	}
+
+	session, err := s.svc.CreateSession(addr.String(), domain, s.sessionTTL)
+	if err != nil {
+		s.log(r).Error().Err(err).Str("addr", addr.String()).Msg("Failed to create session")
+		writeError(w, "Failed to create session", http.StatusInternalServerError)
+		return
+	}
+	setRequestUser(r, addr.String(), "proof")
+	s.audit(r, addr.String(), AuditLogin, map[string]string{"domain": domain})
+
+	// Create and set the signed session cookie
+	http.SetCookie(w, s.sessionCookie(session))
+
+	s.writeJSON(w, map[string]any{"ok": true, "expires_at": session.ExpiresAt.Unix()})
+}
+
+func (s *Server) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Logout is allowed even with invalid or expired session, cookie is cleared anyway
+	session, _, err := s.checkSession(r)
+	if err == nil {
+		if err = s.svc.RevokeSession(session.OwnerAddr, session.ID); err != nil {
+			s.log(r).Error().Err(err).Str("addr", session.OwnerAddr).Msg("Failed to revoke session")
+			writeError(w, "Failed to revoke session", http.StatusInternalServerError)
+			return
+		}
+	}
+	s.clearSessionCookie(w)
+
+	s.writeJSON(w, map[string]bool{"ok": true})
+}
+
+func (s *Server) logoutAllHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
+	if r.Method != http.MethodPost {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	num, err := s.svc.RevokeAllSessions(addr.String())
+	if err != nil {
+		s.log(r).Error().Err(err).Str("addr", addr.String()).Msg("Failed to revoke sessions")
+		writeError(w, "Failed to revoke sessions", http.StatusInternalServerError)
+		return
+	}
+	s.clearSessionCookie(w)
+	s.audit(r, addr.String(), AuditLogoutAll, map[string]string{"revoked": strconv.Itoa(num)})
+
+	s.writeJSON(w, map[string]any{"ok": true, "revoked": num})
 }
 
 func (s *Server) securityHandler(next func(http.ResponseWriter, *http.Request), rateLimitStores ...limiter.Store) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if origin := r.Header.Get("Origin"); origin != "" {
-			originURL, err := url.Parse(r.Header.Get("Origin"))
-			if err != nil || originURL.Hostname() != s.domain {
-				http.Error(w, "Origin is incorrect, expected is "+s.domain, http.StatusForbidden)
+			if !s.origins.allowed(origin) {
+				writeError(w, "Origin is not allowed", http.StatusForbidden)
+				return
+			}
+			setCORSHeaders(w, origin)
+
+			if isPreflight(r) {
+				writePreflight(w)
 				return
 			}
 		}
 
+		var key string
+		if len(rateLimitStores) > 0 {
+			key = s.rateLimitKey(r)
+		}
+
 		for _, rateLimitStore := range rateLimitStores {
-			key, _, _ := strings.Cut(r.RemoteAddr, ":")
 			_, _, _, ok, err := rateLimitStore.Take(r.Context(), key)
 			if err != nil {
-				http.Error(w, "Rate error", http.StatusForbidden)
+				writeError(w, "Rate error", http.StatusForbidden)
 				return
 			}
 
 			if !ok {
-				http.Error(w, "Too many requests", http.StatusTooManyRequests)
+				rateLimitRejections.WithLabelValues(getRequestInfo(r.Context()).Route).Inc()
+				writeError(w, "Too many requests", http.StatusTooManyRequests)
 				return
 			}
 		}
@@ -144,254 +404,1430 @@ func (s *Server) securityHandler(next func(http.ResponseWriter, *http.Request),
 	}
 }
 
-func (s *Server) authHandler(next func(http.ResponseWriter, *http.Request, *address.Address)) http.HandlerFunc {
+// authHandler authorizes request by session cookie or by api token with the required scope
+func (s *Server) authHandler(scope string, next func(http.ResponseWriter, *http.Request, *address.Address)) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		cookie, err := r.Cookie("session")
-		if err != nil || cookie.Value == "" {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
-		}
-
-		// Validate the session ID
-		parts := strings.SplitN(cookie.Value, ":", 2)
-		if len(parts) != 2 {
-			http.Error(w, "Invalid session format", http.StatusUnauthorized)
-			return
+		var addr *address.Address
+		var err error
+		auth := "session"
+		if r.Header.Get("Authorization") != "" {
+			auth = "token"
+			addr, err = s.checkToken(r, scope)
+		} else {
+			_, addr, err = s.checkSession(r)
 		}
 
-		signature, sessionData := parts[0], parts[1]
-
-		// Recreate the signed message to verify the signature
-		signedMessage := []byte(sessionData)
-		sigBytes, err := hex.DecodeString(signature)
-		if err != nil || !ed25519.Verify(s.key.Public().(ed25519.PublicKey), signedMessage, sigBytes) {
-			http.Error(w, "Invalid session signature", http.StatusUnauthorized)
-			return
-		}
-
-		// Extract and parse the session data
-		dataParts := strings.SplitN(sessionData, ":", 2)
-		if len(dataParts) != 2 {
-			http.Error(w, "Invalid session data format", http.StatusUnauthorized)
+		if err != nil {
+			s.log(r).Debug().Err(err).Msg("Authorization rejected")
+			s.writeServiceError(w, r, err, "Failed to check authorization")
 			return
 		}
 
-		addr, err := address.ParseAddr(dataParts[1])
-		if err != nil {
-			http.Error(w, "Invalid address", http.StatusBadRequest)
-		}
+		setRequestUser(r, addr.String(), auth)
 
 		// Proceed to the next handler
 		next(w, r, addr)
 	}
 }
 
-func (s *Server) removeHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
+// meHandler returns user's plan limits and current usage
+func (s *Server) meHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
+	if r.Method != http.MethodGet {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	quota, err := s.svc.GetQuota(addr.String())
+	if err != nil {
+		s.writeServiceError(w, r, err, "Failed to get quota")
+		return
+	}
+
+	s.writeJSON(w, quota)
+}
+
+func (s *Server) tokenCreateHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Parse fileName from query parameters
-	query := r.URL.Query()
-	fileName := query.Get("fileName")
-	if fileName == "" {
-		http.Error(w, "Missing 'fileName' query parameter", http.StatusBadRequest)
+	var params TokenParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		s.log(r).Debug().Err(err).Msg("Failed to decode request body")
+		writeError(w, "Invalid request payload", http.StatusBadRequest)
 		return
 	}
 
-	// Attempt to remove the file using the service
-	err := s.svc.RemoveFile(addr.String(), fileName)
+	token, err := s.svc.CreateAPIToken(addr.String(), params)
 	if err != nil {
-		s.logger.Debug().Err(err).Msg("Failed to remove file")
-		http.Error(w, "Failed to remove file", http.StatusInternalServerError)
+		s.writeServiceError(w, r, err, "Failed to create token")
 		return
 	}
+	s.audit(r, addr.String(), AuditTokenCreate, map[string]string{"id": token.ID, "scopes": strings.Join(token.Scopes, ",")})
 
-	w.WriteHeader(http.StatusOK)
+	s.writeJSON(w, token)
 }
 
-func (s *Server) getDeployDataHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
+func (s *Server) tokenListHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Parse fileName from query parameters
-	query := r.URL.Query()
-	fileName := query.Get("fileName")
-	if fileName == "" {
-		http.Error(w, "Missing 'fileName' query parameter", http.StatusBadRequest)
+	tokens, err := s.svc.ListAPITokens(addr.String())
+	if err != nil {
+		s.writeServiceError(w, r, err, "Failed to list tokens")
 		return
 	}
 
-	// Retrieve deploy data from the service
-	deployData, err := s.svc.GetDeployData(r.Context(), addr.String(), fileName)
-	if err != nil {
-		s.logger.Debug().Err(err).Msg("Failed to get deploy data")
-		http.Error(w, "Failed to retrieve deploy data", http.StatusInternalServerError)
+	s.writeJSON(w, tokens)
+}
+
+func (s *Server) tokenRevokeHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
+	if r.Method != http.MethodPost {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Return the deploy data as JSON response
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(deployData); err != nil {
-		s.logger.Debug().Err(err).Msg("Failed to encode deploy data response")
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeError(w, "Missing 'id' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.svc.RevokeAPIToken(addr.String(), id); err != nil {
+		s.writeServiceError(w, r, err, "Failed to revoke token")
 		return
 	}
+	s.audit(r, addr.String(), AuditTokenRevoke, map[string]string{"id": id})
+
+	w.WriteHeader(http.StatusOK)
 }
 
-func (s *Server) getWithdrawDataHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
+// auditHandler returns user's own audit log, newest first, 'before' is created_at of the last entry of the previous page
+func (s *Server) auditHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Parse fileName from query parameters
-	query := r.URL.Query()
-	fileName := query.Get("fileName")
-	if fileName == "" {
-		http.Error(w, "Missing 'fileName' query parameter", http.StatusBadRequest)
+	before, limit, ok := parseLogPage(w, r.URL.Query())
+	if !ok {
 		return
 	}
 
-	data, err := s.svc.GetWithdrawData(r.Context(), addr.String(), fileName)
+	entries, err := s.svc.ListAuditEntries(addr.String(), before, limit)
 	if err != nil {
-		s.logger.Debug().Err(err).Msg("Failed to get deploy data")
-		http.Error(w, "Failed to retrieve deploy data", http.StatusInternalServerError)
+		s.writeServiceError(w, r, err, "Failed to get audit log")
 		return
 	}
 
-	// Return the deploy data as JSON response
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(data); err != nil {
-		s.logger.Debug().Err(err).Msg("Failed to encode withdraw data response")
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
-		return
-	}
+	s.writeJSON(w, entries)
 }
 
-func (s *Server) getTopupDataHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
+func (s *Server) notificationsHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Parse query parameters for additional data if needed
-	query := r.URL.Query()
-	fileName := query.Get("fileName")
-	if fileName == "" {
-		http.Error(w, "Missing 'fileName' query parameter", http.StatusBadRequest)
+	before, limit, ok := parseLogPage(w, r.URL.Query())
+	if !ok {
 		return
 	}
 
-	// Retrieve topup data from the service
-	data, err := s.svc.GetTopupData(r.Context(), addr.String(), fileName)
+	list, err := s.svc.ListNotifications(addr.String(), before, limit)
 	if err != nil {
-		s.logger.Debug().Err(err).Msg("Failed to get topup data")
-		http.Error(w, "Failed to retrieve topup data", http.StatusInternalServerError)
+		s.writeServiceError(w, r, err, "Failed to get notifications")
 		return
 	}
 
-	// Return the topup data as JSON response
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(data); err != nil {
-		s.logger.Debug().Err(err).Msg("Failed to encode topup data response")
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
-		return
+	s.writeJSON(w, list)
+}
+
+// parseLogPage parses 'before' and 'limit' of log pages, error is written when they are invalid
+func parseLogPage(w http.ResponseWriter, query url.Values) (time.Time, int, bool) {
+	var before time.Time
+	if v := query.Get("before"); v != "" {
+		var err error
+		if before, err = time.Parse(time.RFC3339Nano, v); err != nil {
+			writeError(w, "Invalid 'before' query parameter", http.StatusBadRequest)
+			return time.Time{}, 0, false
+		}
 	}
+
+	var limit int
+	if v := query.Get("limit"); v != "" {
+		l, err := strconv.Atoi(v)
+		if err != nil || l <= 0 {
+			writeError(w, "Invalid 'limit' query parameter", http.StatusBadRequest)
+			return time.Time{}, 0, false
+		}
+		limit = l
+	}
+	return before, limit, true
 }
 
-func (s *Server) listHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+func (s *Server) notifySettingsHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
+	switch r.Method {
+	case http.MethodGet:
+		settings, err := s.svc.GetNotifySettings(addr.String())
+		if err != nil {
+			s.writeServiceError(w, r, err, "Failed to get notification settings")
+			return
+		}
+		s.writeJSON(w, settings)
+	case http.MethodPost:
+		var params NotifySettingsParams
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			s.log(r).Debug().Err(err).Msg("Failed to decode request body")
+			writeError(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+
+		settings, err := s.svc.SetNotifySettings(r.Context(), addr.String(), params)
+		if err != nil {
+			s.writeServiceError(w, r, err, "Failed to set notification settings")
+			return
+		}
+		s.audit(r, addr.String(), AuditNotifySettings, map[string]string{
+			"webhook":       strconv.FormatBool(settings.WebhookURL != ""),
+			"telegram":      strconv.FormatBool(settings.TelegramChatID != 0),
+			"rotate_secret": strconv.FormatBool(params.RotateSecret),
+		})
+
+		s.writeJSON(w, settings)
+	default:
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) notifyTestHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
+	if r.Method != http.MethodPost {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Fetch the list of files for the user from the service
-	files, err := s.svc.ListFilesByUser(addr.String())
-	if err != nil {
-		s.logger.Debug().Err(err).Msg("Failed to list files")
-		http.Error(w, "Failed to list files", http.StatusInternalServerError)
+	if err := s.svc.SendTestNotification(addr.String()); err != nil {
+		s.writeServiceError(w, r, err, "Failed to send test notification")
 		return
 	}
 
-	// Convert the file information to JSON response
-	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(files); err != nil {
-		s.logger.Debug().Err(err).Msg("Failed to encode response")
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
-		return
+}
+
+// notifyTelegramHandler creates code to link telegram chat via the bot (POST) or unlinks the chat (DELETE)
+func (s *Server) notifyTelegramHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
+	switch r.Method {
+	case http.MethodPost:
+		link, err := s.svc.CreateTelegramLink(addr.String())
+		if err != nil {
+			s.writeServiceError(w, r, err, "Failed to create telegram link")
+			return
+		}
+		s.writeJSON(w, link)
+	case http.MethodDelete:
+		if err := s.svc.UnlinkTelegram(addr.String()); err != nil {
+			s.writeServiceError(w, r, err, "Failed to unlink telegram")
+			return
+		}
+		s.audit(r, addr.String(), AuditTelegramUnlink, nil)
+		w.WriteHeader(http.StatusOK)
+	default:
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
 	}
 }
 
-func (s *Server) uploadHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
+func (s *Server) webhookCreateHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Parse the multipart form
-	err := r.ParseMultipartForm(int64(s.maxFileSz))
+	var params WebhookParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		s.log(r).Debug().Err(err).Msg("Failed to decode request body")
+		writeError(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	hook, err := s.svc.CreateWebhook(r.Context(), addr.String(), params)
 	if err != nil {
-		http.Error(w, "Unable to parse form", http.StatusBadRequest)
+		s.writeServiceError(w, r, err, "Failed to create webhook")
 		return
 	}
+	s.audit(r, addr.String(), AuditWebhookCreate, map[string]string{"id": hook.ID, "events": strings.Join(hook.Events, ",")})
 
-	// Retrieve the file
-	file, handler, err := r.FormFile("file")
+	s.writeJSON(w, hook)
+}
+
+func (s *Server) webhookListHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
+	if r.Method != http.MethodGet {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	hooks, err := s.svc.ListWebhooks(addr.String())
 	if err != nil {
-		http.Error(w, "Error retrieving the file", http.StatusBadRequest)
+		s.writeServiceError(w, r, err, "Failed to list webhooks")
+		return
+	}
+
+	s.writeJSON(w, hooks)
+}
+
+func (s *Server) webhookRemoveHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
+	if r.Method != http.MethodPost {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeError(w, "Missing 'id' query parameter", http.StatusBadRequest)
 		return
 	}
-	defer file.Close()
 
-	if err = s.svc.StoreFile(file, addr.String(), handler.Filename); err != nil {
-		http.Error(w, "Error storing the file: "+err.Error(), http.StatusInternalServerError)
+	if err := s.svc.RemoveWebhook(addr.String(), id); err != nil {
+		s.writeServiceError(w, r, err, "Failed to remove webhook")
 		return
 	}
+	s.audit(r, addr.String(), AuditWebhookRemove, map[string]string{"id": id})
 
 	w.WriteHeader(http.StatusOK)
 }
 
-// Handler to return data for client to sign as part of the proof
-func (s *Server) getSignDataHandler(w http.ResponseWriter, r *http.Request) {
+// webhookDeliveriesHandler returns deliveries of the webhook, newest first, 'before' is created_at of the last entry of the previous page
+func (s *Server) webhookDeliveriesHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Return the sign data as JSON response
-	response := map[string]string{"data": s.signData()}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	query := r.URL.Query()
+	id := query.Get("id")
+	if id == "" {
+		writeError(w, "Missing 'id' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	before, limit, ok := parseLogPage(w, query)
+	if !ok {
+		return
+	}
+
+	list, err := s.svc.ListWebhookDeliveries(addr.String(), id, before, limit)
+	if err != nil {
+		s.writeServiceError(w, r, err, "Failed to get webhook deliveries")
 		return
 	}
+
+	s.writeJSON(w, list)
 }
 
-func (s *Server) getProviderIdHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+// webhookRedeliverHandler queues delivery with the given id again, as a new delivery of the same event
+func (s *Server) webhookRedeliverHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
+	if r.Method != http.MethodPost {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Return the sign data as JSON response
-	response := map[string]any{"id": strings.ToUpper(hex.EncodeToString(s.svc.providerKey)), "size": s.maxFileSz}
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	if err := json.NewEncoder(w).Encode(response); err != nil {
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeError(w, "Missing 'id' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	delivery, err := s.svc.RedeliverWebhook(addr.String(), id)
+	if err != nil {
+		s.writeServiceError(w, r, err, "Failed to redeliver webhook")
+		return
+	}
+
+	s.writeJSON(w, delivery)
+}
+
+func (s *Server) removeHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
+	if r.Method != http.MethodPost {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Parse fileName from query parameters
+	query := r.URL.Query()
+	fileName := query.Get("fileName")
+	if fileName == "" {
+		writeError(w, "Missing 'fileName' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Attempt to remove the file using the service
+	err := s.svc.RemoveFile(r.Context(), addr.String(), fileName)
+	if err != nil {
+		s.writeServiceError(w, r, err, "Failed to remove file")
 		return
 	}
+	s.audit(r, addr.String(), AuditRemove, map[string]string{"file": fileName})
+
+	w.WriteHeader(http.StatusOK)
 }
 
-func (s *Server) signData() string {
-	return fmt.Sprintf("auth:ton-box:%s", s.domain)
+func (s *Server) getDeployDataHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
+	if r.Method != http.MethodGet {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Parse fileName from query parameters
+	query := r.URL.Query()
+	fileName := query.Get("fileName")
+	if fileName == "" {
+		writeError(w, "Missing 'fileName' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	var replicas int
+	if v := query.Get("replicas"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, "Invalid 'replicas' query parameter", http.StatusBadRequest)
+			return
+		}
+		replicas = n
+	}
+
+	days, ok := parseDays(query)
+	if !ok {
+		writeError(w, "Invalid 'days' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Retrieve deploy data from the service
+	deployData, err := s.svc.GetDeployData(r.Context(), addr.String(), fileName, replicas, days)
+	if err != nil {
+		s.writeServiceError(w, r, err, "Failed to retrieve deploy data")
+		return
+	}
+	s.audit(r, addr.String(), AuditDeployData, map[string]string{"file": fileName, "contract": deployData.ContractAddr, "replicas": strconv.Itoa(len(deployData.Providers))})
+
+	s.writeJSON(w, deployData)
+}
+
+func (s *Server) getWithdrawDataHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
+	if r.Method != http.MethodGet {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Parse fileName from query parameters
+	query := r.URL.Query()
+	fileName := query.Get("fileName")
+	if fileName == "" {
+		writeError(w, "Missing 'fileName' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	data, err := s.svc.GetWithdrawData(r.Context(), addr.String(), fileName)
+	if err != nil {
+		s.writeServiceError(w, r, err, "Failed to retrieve withdraw data")
+		return
+	}
+	s.audit(r, addr.String(), AuditWithdrawData, map[string]string{"file": fileName, "contract": data.ContractAddr})
+
+	s.writeJSON(w, data)
+}
+
+func (s *Server) getTopupDataHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
+	if r.Method != http.MethodGet {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Parse query parameters for additional data if needed
+	query := r.URL.Query()
+	fileName := query.Get("fileName")
+	if fileName == "" {
+		writeError(w, "Missing 'fileName' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	days, ok := parseDays(query)
+	if !ok {
+		writeError(w, "Invalid 'days' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	// Retrieve topup data from the service
+	data, err := s.svc.GetTopupData(r.Context(), addr.String(), fileName, days)
+	if err != nil {
+		s.writeServiceError(w, r, err, "Failed to retrieve topup data")
+		return
+	}
+
+	details := map[string]string{"file": fileName, "contract": data.ContractAddr}
+	if data.Quote != nil {
+		details["days"] = strconv.FormatUint(uint64(days), 10)
+	}
+	s.audit(r, addr.String(), AuditTopupData, details)
+
+	s.writeJSON(w, data)
+}
+
+func (s *Server) quoteHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
+	if r.Method != http.MethodGet {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	params := QuoteParams{
+		FileName: query.Get("fileName"),
+	}
+
+	if v := query.Get("size"); v != "" {
+		size, err := strconv.ParseUint(v, 10, 64)
+		if err != nil || size == 0 {
+			writeError(w, "Invalid 'size' query parameter", http.StatusBadRequest)
+			return
+		}
+		params.Size = size
+	}
+
+	if params.FileName == "" && params.Size == 0 {
+		writeError(w, "Missing 'fileName' or 'size' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	days, ok := parseDays(query)
+	if !ok || days == 0 {
+		writeError(w, "Invalid or missing 'days' query parameter", http.StatusBadRequest)
+		return
+	}
+	params.Days = days
+
+	if v := query.Get("replicas"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, "Invalid 'replicas' query parameter", http.StatusBadRequest)
+			return
+		}
+		params.Replicas = n
+	}
+
+	quote, err := s.svc.GetQuote(r.Context(), addr.String(), params)
+	if err != nil {
+		s.writeServiceError(w, r, err, "Failed to calculate quote")
+		return
+	}
+
+	s.writeJSON(w, quote)
+}
+
+// parseDays parses optional 'days' query parameter, zero is returned when it is not set
+func parseDays(query url.Values) (uint32, bool) {
+	v := query.Get("days")
+	if v == "" {
+		return 0, true
+	}
+
+	days, err := strconv.ParseUint(v, 10, 32)
+	if err != nil || days == 0 {
+		return 0, false
+	}
+	return uint32(days), true
+}
+
+func (s *Server) listHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
+	if r.Method != http.MethodGet {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	params := ListFilesParams{
+		Status: query.Get("status"),
+		Search: query.Get("search"),
+		Sort:   query.Get("sort"),
+		Cursor: query.Get("cursor"),
+	}
+
+	switch query.Get("order") {
+	case "", "desc":
+	case "asc":
+		params.Asc = true
+	default:
+		writeError(w, "Invalid 'order' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			writeError(w, "Invalid 'limit' query parameter", http.StatusBadRequest)
+			return
+		}
+		params.Limit = limit
+	}
+
+	// Fetch the page of files for the user from the service
+	page, err := s.svc.ListFilesByUser(addr.String(), params)
+	if err != nil {
+		s.writeServiceError(w, r, err, "Failed to list files")
+		return
+	}
+
+	// response stays a plain array for compatibility, next page position is passed in header
+	if page.NextCursor != "" {
+		w.Header().Set("X-Next-Cursor", page.NextCursor)
+	}
+	s.writeJSON(w, page.Files)
+}
+
+// eventsHandler streams user's file events as Server-Sent Events, list polling is a fallback
+func (s *Server) eventsHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
+	if r.Method != http.MethodGet {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	events, unsubscribe, err := s.svc.SubscribeEvents(addr.String())
+	if err != nil {
+		s.writeServiceError(w, r, err, "Failed to subscribe")
+		return
+	}
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 5000\n\n")
+	flusher.Flush()
+
+	ping := time.NewTicker(25 * time.Second)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.closing:
+			return
+		case <-ping.C:
+			if _, err = fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case ev := <-events:
+			data, err := json.Marshal(ev)
+			if err != nil {
+				s.log(r).Debug().Err(err).Msg("Failed to encode event")
+				continue
+			}
+
+			if _, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func (s *Server) uploadHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
+	if r.Method != http.MethodPost {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Parse the multipart form
+	err := r.ParseMultipartForm(int64(s.maxFileSz))
+	if err != nil {
+		writeError(w, "Unable to parse form", http.StatusBadRequest)
+		return
+	}
+
+	// Retrieve the file
+	file, handler, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, "Error retrieving the file", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	if err = s.svc.StoreFile(r.Context(), file, addr.String(), handler.Filename, uint64(handler.Size)); err != nil {
+		s.writeServiceError(w, r, err, "Error storing the file")
+		return
+	}
+	s.audit(r, addr.String(), AuditUpload, map[string]string{"file": handler.Filename, "size": strconv.FormatInt(handler.Size, 10)})
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// uploadFolderHandler accepts multipart form with multiple 'file' parts,
+// file name of each part is its path relative to the folder root
+func (s *Server) uploadFolderHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
+	if r.Method != http.MethodPost {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	folderName := r.URL.Query().Get("fileName")
+	if folderName == "" {
+		writeError(w, "Missing 'fileName' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	// reserve some space for multipart headers
+	r.Body = http.MaxBytesReader(w, r.Body, int64(s.maxFileSz)+(10<<20))
+
+	mr, err := r.MultipartReader()
+	if err != nil {
+		writeError(w, "Unable to parse form", http.StatusBadRequest)
+		return
+	}
+
+	next := func() (string, io.Reader, error) {
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				var tooBig *http.MaxBytesError
+				switch {
+				case errors.Is(err, io.EOF):
+					return "", nil, err
+				case errors.As(err, &tooBig):
+					return "", nil, ErrFolderTooBig
+				}
+				return "", nil, fmt.Errorf("%w: malformed multipart body: %v", ErrInvalidInput, err)
+			}
+
+			if part.FormName() != "file" {
+				continue
+			}
+
+			// part.FileName() cuts directories, so we parse header by ourselves
+			_, params, err := mime.ParseMediaType(part.Header.Get("Content-Disposition"))
+			if err != nil || params["filename"] == "" {
+				return "", nil, fmt.Errorf("%w: file name is not specified", ErrInvalidInput)
+			}
+			return params["filename"], part, nil
+		}
+	}
+
+	if err = s.svc.StoreFolder(r.Context(), addr.String(), folderName, s.maxFileSz, next); err != nil {
+		s.writeServiceError(w, r, err, "Error storing the folder")
+		return
+	}
+	s.audit(r, addr.String(), AuditUpload, map[string]string{"file": folderName, "dir": "true"})
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// importHandler registers existing bag by its id, so storage can be ordered without uploading
+func (s *Server) importHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
+	if r.Method != http.MethodPost {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	bagID := query.Get("bagId")
+	if bagID == "" {
+		writeError(w, "Missing 'bagId' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.svc.ImportBag(r.Context(), addr.String(), bagID, query.Get("fileName")); err != nil {
+		s.writeServiceError(w, r, err, "Error importing the bag")
+		return
+	}
+	s.audit(r, addr.String(), AuditImport, map[string]string{"bag_id": bagID, "file": query.Get("fileName")})
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) uploadCreateHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
+	if r.Method != http.MethodPost {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	fileName := query.Get("fileName")
+	if fileName == "" {
+		writeError(w, "Missing 'fileName' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	size, err := strconv.ParseUint(query.Get("size"), 10, 64)
+	if err != nil {
+		writeError(w, "Invalid 'size' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	if size > s.maxFileSz {
+		writeError(w, "File is too big", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	upload, err := s.svc.CreateUpload(r.Context(), addr.String(), fileName, size)
+	if err != nil {
+		s.writeServiceError(w, r, err, "Error creating upload")
+		return
+	}
+
+	s.writeUploadStatus(w, upload)
+}
+
+// uploadChunkHandler accepts raw chunk body at the given offset of the upload
+func (s *Server) uploadChunkHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
+	if r.Method != http.MethodPost {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	id := query.Get("id")
+	if id == "" {
+		writeError(w, "Missing 'id' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	offset, err := strconv.ParseUint(query.Get("offset"), 10, 64)
+	if err != nil {
+		writeError(w, "Invalid 'offset' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	upload, err := s.svc.WriteUploadChunk(r.Context(), addr.String(), id, offset, http.MaxBytesReader(w, r.Body, int64(s.maxFileSz)))
+	if err != nil {
+		s.log(r).Debug().Err(err).Str("id", id).Msg("Failed to write upload chunk")
+
+		if errors.Is(err, ErrUploadOffsetMismatch) {
+			// client should continue from the offset we have
+			w.Header().Set("Upload-Offset", fmt.Sprint(upload.Offset))
+			writeErrorResponse(w, http.StatusConflict, ErrorResponse{
+				Code:    CodeUploadOffsetMismatch,
+				Message: err.Error(),
+				Details: map[string]uint64{"offset": upload.Offset},
+			})
+			return
+		}
+		s.writeServiceError(w, r, err, "Error storing the chunk")
+		return
+	}
+
+	if upload.Completed {
+		s.audit(r, addr.String(), AuditUpload, map[string]string{"file": upload.FileName, "size": strconv.FormatUint(upload.Size, 10), "upload_id": upload.ID})
+	}
+
+	s.writeUploadStatus(w, upload)
+}
+
+func (s *Server) uploadStatusHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
+	if r.Method != http.MethodGet {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeError(w, "Missing 'id' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	upload, err := s.svc.GetUpload(addr.String(), id)
+	if err != nil {
+		s.writeServiceError(w, r, err, "Failed to get upload")
+		return
+	}
+
+	s.writeUploadStatus(w, upload)
+}
+
+func (s *Server) uploadCancelHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
+	if r.Method != http.MethodPost {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeError(w, "Missing 'id' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.svc.CancelUpload(r.Context(), addr.String(), id); err != nil {
+		s.writeServiceError(w, r, err, "Failed to cancel upload")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) writeUploadStatus(w http.ResponseWriter, upload *UploadStatus) {
+	w.Header().Set("Upload-Offset", fmt.Sprint(upload.Offset))
+	s.writeJSON(w, upload)
+}
+
+// downloadHandler streams file content to its owner, range requests are supported
+func (s *Server) downloadHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	fileName := query.Get("fileName")
+	if fileName == "" {
+		writeError(w, "Missing 'fileName' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	file, name, err := s.svc.OpenFile(r.Context(), addr.String(), fileName, query.Get("path"))
+	if err != nil {
+		s.writeServiceError(w, r, err, "Failed to open file")
+		return
+	}
+	defer file.Close()
+
+	s.serveFile(w, r, file, name)
+}
+
+func (s *Server) serveFile(w http.ResponseWriter, r *http.Request, file *os.File, name string) {
+	st, err := file.Stat()
+	if err != nil {
+		s.log(r).Debug().Err(err).Msg("Failed to stat file")
+		writeError(w, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filepath.Base(name)}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// content type is detected from extension or content by ServeContent
+	http.ServeContent(w, r, name, st.ModTime(), file)
+}
+
+func (s *Server) shareCreateHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
+	if r.Method != http.MethodPost {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var params ShareLinkParams
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		s.log(r).Debug().Err(err).Msg("Failed to decode request body")
+		writeError(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	if params.FileName == "" {
+		writeError(w, "Missing 'file_name' parameter", http.StatusBadRequest)
+		return
+	}
+
+	link, err := s.svc.CreateShareLink(addr.String(), params)
+	if err != nil {
+		s.writeServiceError(w, r, err, "Failed to create share link")
+		return
+	}
+
+	s.writeJSON(w, link)
+}
+
+func (s *Server) shareListHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
+	if r.Method != http.MethodGet {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	links, err := s.svc.ListShareLinks(addr.String(), r.URL.Query().Get("fileName"))
+	if err != nil {
+		s.writeServiceError(w, r, err, "Failed to list share links")
+		return
+	}
+
+	s.writeJSON(w, links)
+}
+
+func (s *Server) shareRevokeHandler(w http.ResponseWriter, r *http.Request, addr *address.Address) {
+	if r.Method != http.MethodPost {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		writeError(w, "Missing 'id' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.svc.RevokeShareLink(addr.String(), id); err != nil {
+		s.writeServiceError(w, r, err, "Failed to revoke share link")
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// publicDownloadHandler streams shared file without authorization,
+// password can be passed in X-Share-Password header or 'password' query parameter
+func (s *Server) publicDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	id := query.Get("id")
+	if id == "" {
+		writeError(w, "Missing 'id' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	password := r.Header.Get("X-Share-Password")
+	if password == "" {
+		password = query.Get("password")
+	}
+
+	// every request which serves content is counted, partial ones too, otherwise whole file
+	// can be read by ranges without touching the limit
+	count := r.Method == http.MethodGet
+
+	file, name, err := s.svc.OpenSharedFile(r.Context(), id, password, query.Get("path"), count)
+	if err != nil {
+		if errors.Is(err, ErrFileNotFound) {
+			// do not reveal that link exists while its file is gone
+			err = ErrShareLinkNotFound
+		}
+		s.writeServiceError(w, r, err, "Failed to open file")
+		return
+	}
+	defer file.Close()
+
+	s.serveFile(w, r, file, name)
+}
+
+func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := s.svc.CheckLiveness(); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]any{"ok": false, "error": err.Error()})
+		return
+	}
+
+	s.writeJSON(w, map[string]bool{"ok": true})
+}
+
+func (s *Server) readyHandler(w http.ResponseWriter, r *http.Request) {
+	select {
+	case <-s.closing:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]any{"ready": false, "error": "shutting down"})
+		return
+	default:
+	}
+
+	// result is shared with other probes, so it should not depend on this client
+	report := s.svc.CheckReadiness(context.WithoutCancel(r.Context()))
+
+	code := http.StatusOK
+	if !report.Ready {
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		s.log(r).Debug().Err(err).Msg("Failed to encode readiness response")
+		return
+	}
+}
+
+// Handler to return data for client to sign as part of the proof
+func (s *Server) getSignDataHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	payload, err := s.newProofPayload()
+	if err != nil {
+		s.log(r).Error().Err(err).Msg("Failed to generate proof payload")
+		writeError(w, "Failed to generate sign data", http.StatusInternalServerError)
+		return
+	}
+
+	// Return the sign data as JSON response
+	response := map[string]string{"data": payload}
+	s.writeJSON(w, response)
+}
+
+func (s *Server) getProviderIdHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Return the sign data as JSON response
+	replicas, err := s.svc.MaxReplicas()
+	if err != nil {
+		s.writeServiceError(w, r, err, "Failed to get providers")
+		return
+	}
+
+	response := map[string]any{"id": strings.ToUpper(hex.EncodeToString(s.svc.providerKey)), "size": s.maxFileSz, "max_replicas": replicas}
+	s.writeJSON(w, response)
+}
+
+// providersHandler ranks offers of known providers for the bag size, from the cheapest
+func (s *Server) providersHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	size, err := strconv.ParseUint(r.URL.Query().Get("size"), 10, 64)
+	if err != nil || size == 0 {
+		writeError(w, "Invalid 'size' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	offers, err := s.svc.RankProviders(size, false)
+	if err != nil {
+		s.writeServiceError(w, r, err, "Failed to rank providers")
+		return
+	}
+
+	s.writeJSON(w, offers)
+}
+
+// adminHandler allows request with the configured admin key, or with a session of one of admin wallets
+func (s *Server) adminHandler(next func(http.ResponseWriter, *http.Request, string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if key := r.Header.Get("X-Admin-Key"); key != "" {
+			if s.adminKey == "" || subtle.ConstantTimeCompare([]byte(key), []byte(s.adminKey)) != 1 {
+				s.log(r).Warn().Str("remote", s.clientIP(r)).Msg("Invalid admin key")
+				writeError(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			setRequestUser(r, "", "admin-key")
+			next(w, r, "admin-key")
+			return
+		}
+
+		_, addr, err := s.checkSession(r)
+		if err != nil {
+			s.writeServiceError(w, r, err, "Failed to check authorization")
+			return
+		}
+
+		admin, err := NormalizeAddress(addr.String())
+		if err != nil || !s.admins[admin] {
+			writeError(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		setRequestUser(r, admin, "admin")
+
+		next(w, r, admin)
+	}
+}
+
+func (s *Server) adminUsersHandler(w http.ResponseWriter, r *http.Request, admin string) {
+	if r.Method != http.MethodGet {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	limit, ok := parseAdminLimit(query)
+	if !ok {
+		writeError(w, "Invalid 'limit' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	users, err := s.svc.AdminListUsers(query.Get("after"), limit)
+	if err != nil {
+		s.writeServiceError(w, r, err, "Failed to list users")
+		return
+	}
+
+	s.writeJSON(w, users)
+}
+
+func (s *Server) adminFilesHandler(w http.ResponseWriter, r *http.Request, admin string) {
+	if r.Method != http.MethodGet {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	limit, ok := parseAdminLimit(query)
+	if !ok {
+		writeError(w, "Invalid 'limit' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	after := query.Get("after")
+	user := query.Get("user")
+	if user != "" {
+		var err error
+		if user, err = NormalizeAddress(user); err != nil {
+			writeError(w, "Invalid 'user' query parameter", http.StatusBadRequest)
+			return
+		}
+		if after == "" {
+			// keys are sorted, so iteration starts right before the user's files
+			after = user
+		}
+	}
+
+	files, err := s.svc.AdminListFiles(after, limit)
+	if err != nil {
+		s.writeServiceError(w, r, err, "Failed to list files")
+		return
+	}
+
+	if user != "" {
+		for i, f := range files {
+			if f.OwnerAddr != user {
+				files = files[:i]
+				break
+			}
+		}
+	}
+
+	s.writeJSON(w, files)
+}
+
+// parseAdminLimit returns page size of admin lists, 100 by default
+func parseAdminLimit(query url.Values) (int, bool) {
+	v := query.Get("limit")
+	if v == "" {
+		return 100, true
+	}
+
+	l, err := strconv.Atoi(v)
+	if err != nil || l <= 0 || l > 1000 {
+		return 0, false
+	}
+	return l, true
+}
+
+func (s *Server) adminTasksHandler(w http.ResponseWriter, r *http.Request, admin string) {
+	if r.Method != http.MethodGet {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tasks, err := s.svc.AdminListTasks(r.URL.Query().Get("type"))
+	if err != nil {
+		s.writeServiceError(w, r, err, "Failed to list tasks")
+		return
+	}
+
+	s.writeJSON(w, tasks)
+}
+
+func (s *Server) adminRequeueHandler(w http.ResponseWriter, r *http.Request, admin string) {
+	if r.Method != http.MethodPost {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	typ, key := query.Get("type"), query.Get("key")
+	if key == "" {
+		writeError(w, "Missing 'key' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.svc.AdminRequeueTask(typ, key); err != nil {
+		s.writeServiceError(w, r, err, "Failed to requeue task")
+		return
+	}
+
+	s.log(r).Info().Str("admin", admin).Str("type", typ).Str("key", key).Msg("Task requeued by admin")
+	s.audit(r, keyOwner(key), AuditAdminRequeue, map[string]string{"type": typ, "key": key})
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) adminRemoveHandler(w http.ResponseWriter, r *http.Request, admin string) {
+	if r.Method != http.MethodPost {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	key := r.URL.Query().Get("key")
+	if key == "" {
+		writeError(w, "Missing 'key' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.svc.AdminRemoveFile(key); err != nil {
+		s.writeServiceError(w, r, err, "Failed to remove file")
+		return
+	}
+
+	s.log(r).Info().Str("admin", admin).Str("key", key).Msg("File removed by admin")
+	s.audit(r, keyOwner(key), AuditAdminRemove, map[string]string{"key": key})
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) adminBansHandler(w http.ResponseWriter, r *http.Request, admin string) {
+	if r.Method != http.MethodGet {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	bans, err := s.svc.ListBans()
+	if err != nil {
+		s.writeServiceError(w, r, err, "Failed to list bans")
+		return
+	}
+
+	s.writeJSON(w, bans)
+}
+
+// adminBanHandler bans (POST) or unbans (DELETE) the address from uploading
+func (s *Server) adminBanHandler(w http.ResponseWriter, r *http.Request, admin string) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	userAddr, err := NormalizeAddress(query.Get("address"))
+	if err != nil {
+		writeError(w, "Invalid 'address' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		err = s.svc.UnbanUser(userAddr)
+	} else {
+		err = s.svc.BanUser(userAddr, query.Get("reason"))
+	}
+	if err != nil {
+		s.writeServiceError(w, r, err, "Failed to update ban")
+		return
+	}
+
+	s.log(r).Info().Str("admin", admin).Str("addr", userAddr).Bool("banned", r.Method == http.MethodPost).Msg("User ban updated by admin")
+	if r.Method == http.MethodPost {
+		s.audit(r, userAddr, AuditAdminBan, map[string]string{"reason": query.Get("reason")})
+	} else {
+		s.audit(r, userAddr, AuditAdminUnban, nil)
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// adminPlanHandler returns (GET), sets (POST) or removes (DELETE) plan override of the address
+func (s *Server) adminPlanHandler(w http.ResponseWriter, r *http.Request, admin string) {
+	userAddr, err := NormalizeAddress(r.URL.Query().Get("address"))
+	if err != nil {
+		writeError(w, "Invalid 'address' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var plan db.PlanOverride
+		if err = json.NewDecoder(r.Body).Decode(&plan); err != nil {
+			writeError(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+		err = s.svc.SetUserPlan(userAddr, plan)
+	case http.MethodDelete:
+		err = s.svc.DeleteUserPlan(userAddr)
+	default:
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		s.writeServiceError(w, r, err, "Failed to update plan")
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		s.log(r).Info().Str("admin", admin).Str("addr", userAddr).Str("method", r.Method).Msg("User plan updated by admin")
+		s.audit(r, userAddr, AuditAdminPlan, map[string]string{"method": r.Method})
+	}
+
+	quota, err := s.svc.GetQuota(userAddr)
+	if err != nil {
+		s.writeServiceError(w, r, err, "Failed to get quota")
+		return
+	}
+
+	s.writeJSON(w, quota)
+}
+
+// adminProvidersHandler lists all providers (GET), adds or enables (POST) and disables (DELETE) provider by key
+func (s *Server) adminProvidersHandler(w http.ResponseWriter, r *http.Request, admin string) {
+	query := r.URL.Query()
+	if r.Method == http.MethodGet {
+		offers, err := s.svc.RankProviders(1<<20, true)
+		if err != nil {
+			s.writeServiceError(w, r, err, "Failed to list providers")
+			return
+		}
+		s.writeJSON(w, offers)
+		return
+	}
+
+	key, err := hex.DecodeString(query.Get("key"))
+	if err != nil || len(key) != 32 {
+		writeError(w, "Invalid 'key' query parameter", http.StatusBadRequest)
+		return
+	}
+
+	var action string
+	switch r.Method {
+	case http.MethodPost:
+		action = AuditAdminProviderAdd
+		err = s.svc.AddProvider(key, query.Get("name"), admin)
+	case http.MethodDelete:
+		action = AuditAdminProviderDisable
+		err = s.svc.DisableProvider(key)
+	default:
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		s.writeServiceError(w, r, err, "Failed to update provider")
+		return
+	}
+
+	details := map[string]string{"key": strings.ToUpper(hex.EncodeToString(key))}
+	if name := query.Get("name"); name != "" {
+		details["name"] = name
+	}
+	s.audit(r, admin, action, details)
+
+	s.log(r).Info().Str("admin", admin).Hex("key", key).Str("method", r.Method).Msg("Provider updated by admin")
+	w.WriteHeader(http.StatusOK)
+}
+
+// adminMetricsHandler serves prometheus metrics, when no separate metrics address is configured
+func (s *Server) adminMetricsHandler(w http.ResponseWriter, r *http.Request, admin string) {
+	promhttp.Handler().ServeHTTP(w, r)
+}
+
+func (s *Server) adminDiskHandler(w http.ResponseWriter, r *http.Request, admin string) {
+	if r.Method != http.MethodGet {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s.writeJSON(w, s.svc.GetDiskUsage())
 }
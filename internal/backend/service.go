@@ -1,10 +1,12 @@
 package backend
 
 import (
+	"bytes"
 	"context"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
 	"github.com/xssnick/ton-provider-web/internal/backend/db"
 	"github.com/xssnick/ton-provider-web/internal/backend/storage"
@@ -14,10 +16,13 @@ import (
 	"github.com/xssnick/tonutils-storage-provider/pkg/contract"
 	"github.com/xssnick/tonutils-storage-provider/pkg/transport"
 	"io"
+	"math/big"
+	"net/http"
 	"os"
 	"path/filepath"
-	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -28,12 +33,31 @@ type Service struct {
 	logger         zerolog.Logger
 	api            ton.APIClientWrapped
 	freeStore      time.Duration
+	uploadLocks    sync.Map
+	events         *eventHub
+	readiness      readinessCache
 
+	stop       chan struct{}
+	stopOnce   sync.Once
+	workerDone chan struct{}
+
+	// providerKey is the primary provider, others are in the providers registry
 	providerKey []byte
 	provider    *transport.Client
+	defaultPlan db.Plan
+	telegram    TelegramConfig
+
+	// hooks restricts user's webhooks to public addresses, notifyClient is for operator configured endpoints
+	hooks        *webhookGuard
+	notifyClient *http.Client
+
+	// unix time of the last providers poll
+	providersPolledAt atomic.Int64
+	// telegramOffset is the next telegram update to receive, used only by the telegram loop
+	telegramOffset int64
 }
 
-func NewService(db *db.Database, api ton.APIClientWrapped, provider *transport.Client, providerKey []byte, stg *storage.Client, storageBaseDir string, logger zerolog.Logger) *Service {
+func NewService(db *db.Database, api ton.APIClientWrapped, provider *transport.Client, providerKey []byte, stg *storage.Client, storageBaseDir string, defaultPlan db.Plan, notify NotifyConfig, logger zerolog.Logger) *Service {
 	path, err := filepath.Abs(storageBaseDir)
 	if err != nil {
 		logger.Fatal().Err(err).Msg("Failed to get absolute path to storage directory")
@@ -48,19 +72,30 @@ func NewService(db *db.Database, api ton.APIClientWrapped, provider *transport.C
 		storageBaseDir: path,
 		provider:       provider,
 		providerKey:    providerKey,
+		defaultPlan:    defaultPlan,
+		telegram:       notify.Telegram,
+		hooks:          newWebhookGuard(notify.WebhookDevMode, notify.DeniedHosts, logger),
+		notifyClient:   &http.Client{CheckRedirect: noRedirect},
 		freeStore:      15 * time.Minute,
+		events:         newEventHub(),
+		stop:           make(chan struct{}),
+		workerDone:     make(chan struct{}),
 		logger:         logger,
 	}
-	go s.worker()
+	prometheus.MustRegister(newStatsCollector(db))
+
+	s.startWorkers()
 	return s
 }
 
 type UserFileInfo struct {
-	FileName  string    `json:"file_name"`
-	CreatedAt time.Time `json:"created_at"`
-	Size      uint64    `json:"size"`
-	Status    string    `json:"status"`
-	BagID     string    `json:"bag_id"`
+	FileName  string        `json:"file_name"`
+	CreatedAt time.Time     `json:"created_at"`
+	Size      uint64        `json:"size"`
+	Status    string        `json:"status"`
+	BagID     string        `json:"bag_id"`
+	Dir       bool          `json:"dir"`
+	Files     []BagFileInfo `json:"files,omitempty"`
 
 	ExpireAt *time.Time `json:"expire_at"`
 
@@ -70,72 +105,102 @@ type UserFileInfo struct {
 	ContractBalance string `json:"contract_balance"`
 	ContractAddr    string `json:"contract_addr"`
 	TimeLeft        string `json:"time_left"`
+
+	Providers []UserProviderInfo `json:"providers,omitempty"`
+
+	ShareLinks int `json:"share_links"`
 }
 
-func (s *Service) ListFilesByUser(userAddr string) ([]UserFileInfo, error) {
-	// Retrieve file information from the database for the given user address
-	files, err := s.db.GetFilesByUser(userAddr)
-	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve files for user %s: %w", userAddr, err)
-	}
+type UserProviderInfo struct {
+	Key             string `json:"key"`
+	Status          string `json:"status"`
+	Reason          string `json:"reason"`
+	Error           string `json:"error,omitempty"`
+	ContractBalance string `json:"contract_balance"`
+	PricePerDay     string `json:"price_per_day"`
+	TimeLeft        string `json:"time_left"`
+}
 
-	fileKeys := make([]string, 0, len(files))
-	userFiles := make([]UserFileInfo, 0, len(files))
-	for _, file := range files {
-		var expireAt *time.Time
-		if file.State <= db.FileStateBag {
-			// should be removed
-			at := file.CreatedAt.Add(s.freeStore)
-			if at.Before(time.Now()) {
-				continue
-			}
-			expireAt = &at
-		}
+var fileStatuses = map[int]string{
+	db.FileStateNew:    "processing",
+	db.FileStateBag:    "deploy",
+	db.FileStateStored: "stored",
+}
 
-		// Convert db.FileInfo into UserFileInfo
-		userFile := UserFileInfo{
-			FileName:     file.FilePath,
-			CreatedAt:    file.CreatedAt,
-			Status:       map[int]string{0: "processing", 1: "deploy", 2: "stored"}[file.State],
-			ContractAddr: file.ContractAddr,
-			ExpireAt:     expireAt,
-		}
+// toUserFileInfo converts db.FileInfo into UserFileInfo
+func (s *Service) toUserFileInfo(file *db.FileInfo) UserFileInfo {
+	var expireAt *time.Time
+	if file.State <= db.FileStateBag {
+		at := file.CreatedAt.Add(s.freeStore)
+		expireAt = &at
+	}
 
-		if file.State >= db.FileStateBag {
-			userFile.Size = file.Bag.FullSize
-			userFile.BagID = hex.EncodeToString(file.Bag.RootHash)
-		}
+	userFile := UserFileInfo{
+		FileName:     file.FilePath,
+		CreatedAt:    file.CreatedAt,
+		Status:       fileStatuses[file.State],
+		ContractAddr: file.ContractAddr,
+		Dir:          file.Dir,
+		ExpireAt:     expireAt,
+	}
 
-		if file.State >= db.FileStateStored {
-			userFile.ProviderStatus = file.Provider.Status
-			userFile.ProviderReason = file.Provider.Reason
-			userFile.ContractBalance = file.Provider.Balance
-			userFile.PricePerDay = file.Provider.PerDay
-			userFile.TimeLeft = file.Provider.Left
+	if file.State >= db.FileStateBag {
+		userFile.Size = file.Bag.FullSize
+		userFile.BagID = hex.EncodeToString(file.Bag.RootHash)
+
+		for _, f := range file.Bag.Files {
+			userFile.Files = append(userFile.Files, BagFileInfo{Name: f.Name, Size: f.Size})
 		}
-		userFiles = append(userFiles, userFile)
-		fileKeys = append(fileKeys, file.FilePath)
 	}
 
-	if err := s.db.RefreshUserIfNeeded(userAddr, fileKeys, 5); err != nil {
-		s.logger.Warn().Err(err).Msg("failed to refresh user files")
+	if file.State >= db.FileStateStored {
+		userFile.ProviderStatus = file.Provider.Status
+		userFile.ProviderReason = file.Provider.Reason
+		userFile.ContractBalance = file.Provider.Balance
+		userFile.PricePerDay = file.Provider.PerDay
+		userFile.TimeLeft = file.Provider.Left
+
+		for _, p := range file.Provider.Providers {
+			userFile.Providers = append(userFile.Providers, UserProviderInfo{
+				Key:             strings.ToUpper(hex.EncodeToString(p.Key)),
+				Status:          p.Status,
+				Reason:          p.Reason,
+				Error:           p.Error,
+				ContractBalance: p.Balance,
+				PricePerDay:     p.PerDay,
+				TimeLeft:        p.Left,
+			})
+		}
 	}
+	return userFile
+}
 
-	sort.Slice(userFiles, func(i, j int) bool {
-		return userFiles[i].CreatedAt.After(userFiles[j].CreatedAt)
-	})
-
-	return userFiles, nil
+type BagFileInfo struct {
+	Name string `json:"name"`
+	Size uint64 `json:"size"`
 }
 
+// ContractDeployData describes contract with all chosen providers, PerDay is the total price,
+// proof fields are of the first (cheapest) provider and kept for compatibility
 type ContractDeployData struct {
-	ContractAddr  string `json:"contract_addr"`
+	ContractAddr  string                `json:"contract_addr"`
+	PerDay        string                `json:"per_day"`
+	PerProof      string                `json:"per_proof"`
+	ProofEvery    string                `json:"proof_every"`
+	ProofEverySec uint32                `json:"proof_every_sec"`
+	Providers     []ProviderDeployOffer `json:"providers"`
+	StateInit     []byte                `json:"state_init"`
+	Body          []byte                `json:"body"`
+	// Quote is set when days were requested, its amount should be attached to the deploy message
+	Quote *StorageQuote `json:"quote,omitempty"`
+}
+
+type ProviderDeployOffer struct {
+	Key           string `json:"key"`
 	PerDay        string `json:"per_day"`
 	PerProof      string `json:"per_proof"`
 	ProofEvery    string `json:"proof_every"`
 	ProofEverySec uint32 `json:"proof_every_sec"`
-	StateInit     []byte `json:"state_init"`
-	Body          []byte `json:"body"`
 }
 
 type ContractWithdrawData struct {
@@ -145,6 +210,8 @@ type ContractWithdrawData struct {
 
 type ContractTopupData struct {
 	ContractAddr string `json:"contract_addr"`
+	// Quote is set when days were requested, its amount is what should be sent to the contract
+	Quote *StorageQuote `json:"quote,omitempty"`
 }
 
 func (s *Service) GetWithdrawData(ctx context.Context, userAddr, fileName string) (*ContractWithdrawData, error) {
@@ -154,11 +221,11 @@ func (s *Service) GetWithdrawData(ctx context.Context, userAddr, fileName string
 	}
 
 	if fi == nil {
-		return nil, fmt.Errorf("file not found")
+		return nil, ErrFileNotFound
 	}
 
 	if fi.State != db.FileStateStored {
-		return nil, fmt.Errorf("contract not yet deployed")
+		return nil, ErrContractNotDeployed
 	}
 
 	addr, body, err := s.getContractWithdrawData(fi.Bag, address.MustParseAddr(fi.OwnerAddr))
@@ -172,14 +239,23 @@ func (s *Service) GetWithdrawData(ctx context.Context, userAddr, fileName string
 	}, nil
 }
 
-func (s *Service) GetTopupData(ctx context.Context, userAddr, fileName string) (*ContractTopupData, error) {
+// GetTopupData returns contract to topup, when days are not zero amount to have the file stored for them is quoted
+func (s *Service) GetTopupData(ctx context.Context, userAddr, fileName string, days uint32) (*ContractTopupData, error) {
+	if err := checkQuoteDays(days); err != nil {
+		return nil, err
+	}
+
 	fi, err := s.db.GetFile(userAddr, fileName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get file info: %w", err)
 	}
 
+	if fi == nil {
+		return nil, ErrFileNotFound
+	}
+
 	if fi.State != db.FileStateStored {
-		return nil, fmt.Errorf("contract not yet deployed")
+		return nil, ErrContractNotDeployed
 	}
 
 	addr, _, err := s.getContractWithdrawData(fi.Bag, address.MustParseAddr(fi.OwnerAddr))
@@ -187,42 +263,80 @@ func (s *Service) GetTopupData(ctx context.Context, userAddr, fileName string) (
 		return nil, fmt.Errorf("failed to get contract topup data: %w", err)
 	}
 
-	return &ContractTopupData{
+	data := &ContractTopupData{
 		ContractAddr: addr.String(),
-	}, nil
+	}
+
+	if days > 0 {
+		if data.Quote, err = s.topupQuote(ctx, fi, days); err != nil {
+			return nil, fmt.Errorf("failed to quote topup: %w", err)
+		}
+	}
+	return data, nil
 }
 
-func (s *Service) GetDeployData(ctx context.Context, userAddr, fileName string) (*ContractDeployData, error) {
+// GetDeployData prepares contract deploy with the given number of providers, zero means one.
+// When days are not zero, amount to have the file stored by chosen providers for them is quoted
+func (s *Service) GetDeployData(ctx context.Context, userAddr, fileName string, replicas int, days uint32) (*ContractDeployData, error) {
+	if replicas == 0 {
+		replicas = 1
+	}
+	if replicas < 0 {
+		return nil, fmt.Errorf("%w: replicas should be positive", ErrInvalidInput)
+	}
+	if err := checkQuoteDays(days); err != nil {
+		return nil, err
+	}
+
 	fi, err := s.db.GetFile(userAddr, fileName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get file info: %w", err)
 	}
 
 	if fi == nil {
-		return nil, fmt.Errorf("file not found")
+		return nil, ErrFileNotFound
 	}
 
 	if fi.State != db.FileStateBag {
-		return nil, fmt.Errorf("deploy not yet required")
+		return nil, ErrDeployNotRequired
 	}
 
-	off, addr, si, body, err := s.getContractDeployData(ctx, fi.Bag, address.MustParseAddr(fi.OwnerAddr), s.providerKey)
+	offers, addr, si, body, err := s.getContractDeployData(ctx, fi.Bag, address.MustParseAddr(fi.OwnerAddr), replicas)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get contract deploy data: %w", err)
 	}
 
-	return &ContractDeployData{
+	total := new(big.Int)
+	providers := make([]ProviderDeployOffer, 0, len(offers))
+	for _, o := range offers {
+		total.Add(total, o.Offer.PerDayNano)
+		providers = append(providers, ProviderDeployOffer{
+			Key:           strings.ToUpper(hex.EncodeToString(o.Key)),
+			PerDay:        tlb.FromNanoTON(o.Offer.PerDayNano).String(),
+			PerProof:      tlb.FromNanoTON(o.Offer.PerProofNano).String(),
+			ProofEvery:    o.Offer.Every,
+			ProofEverySec: o.Offer.Span,
+		})
+	}
+
+	data := &ContractDeployData{
 		ContractAddr:  addr.String(),
-		PerDay:        tlb.FromNanoTON(off.PerDayNano).String(),
-		PerProof:      tlb.FromNanoTON(off.PerProofNano).String(),
-		ProofEvery:    off.Every,
-		ProofEverySec: off.Span,
+		PerDay:        tlb.FromNanoTON(total).String(),
+		PerProof:      providers[0].PerProof,
+		ProofEvery:    providers[0].ProofEvery,
+		ProofEverySec: providers[0].ProofEverySec,
+		Providers:     providers,
 		StateInit:     si.ToBOC(),
 		Body:          body.ToBOC(),
-	}, nil
+	}
+
+	if days > 0 {
+		data.Quote = buildQuote(offersToQuote(offers), fi.Bag.FullSize, days, new(big.Int))
+	}
+	return data, nil
 }
 
-func (s *Service) RemoveFile(userAddr, fileName string) error {
+func (s *Service) RemoveFile(ctx context.Context, userAddr, fileName string) error {
 	existingFile, err := s.db.GetFile(userAddr, fileName)
 	if err == nil && existingFile == nil {
 		return nil
@@ -232,52 +346,33 @@ func (s *Service) RemoveFile(userAddr, fileName string) error {
 	}
 
 	if existingFile.State >= db.FileStateStored {
-		return fmt.Errorf("file is paid and stored at provider")
+		return ErrFileStored
 	}
 
 	if err := s.db.CreateCleanTask(userAddr, fileName); err != nil {
 		return fmt.Errorf("failed to store file metadata in database: %w", err)
 	}
 
+	ctxLogger(ctx, &s.logger).Debug().Str("addr", userAddr).Str("file", fileName).Msg("file removal requested")
 	return nil
 }
 
-func (s *Service) StoreFile(fileReader io.Reader, userAddr, fileName string) error {
+func (s *Service) StoreFile(ctx context.Context, fileReader io.Reader, userAddr, fileName string, size uint64) error {
 	// Ensure the storage directory exists.
 	if err := os.MkdirAll(filepath.Join(s.storageBaseDir, userAddr), os.ModePerm); err != nil {
 		return err
 	}
 
-	if len(fileName) > 1000 {
-		return fmt.Errorf("file name too long")
-	}
-
-	cleanName := filepath.Base(filepath.Clean(fileName))
-
-	// Validate the fileName to prevent vulnerabilities like directory traversal.
-	if cleanName == "." || cleanName == "" ||
-		strings.Contains(cleanName, "..") ||
-		strings.ContainsRune(cleanName, os.PathSeparator) {
-		return fmt.Errorf("invalid file name: %s", fileName)
+	cleanName, err := validateFileName(fileName)
+	if err != nil {
+		return err
 	}
 
 	// Define the full path for the file.
 	fullFilePath := filepath.Join(s.storageBaseDir, userAddr, cleanName)
 
-	files, err := s.db.GetFilesByUser(userAddr)
-	if err != nil {
-		return fmt.Errorf("failed to retrieve files for user %s: %w", userAddr, err)
-	}
-
-	numPending := 0
-	for _, file := range files {
-		if file.Provider == nil || file.Provider.Status == "error" {
-			numPending++
-		}
-
-		if numPending >= 3 {
-			return fmt.Errorf("too many pending files")
-		}
+	if err = s.checkQuota(userAddr, size); err != nil {
+		return err
 	}
 
 	// Create and open the file on disk.
@@ -288,7 +383,8 @@ func (s *Service) StoreFile(fileReader io.Reader, userAddr, fileName string) err
 	defer file.Close()
 
 	// Write the content to the file from the io.Reader.
-	if _, err := io.Copy(file, fileReader); err != nil {
+	written, err := io.Copy(file, fileReader)
+	if err != nil {
 		return fmt.Errorf("failed to write file content to disk: %w", err)
 	}
 
@@ -297,78 +393,161 @@ func (s *Service) StoreFile(fileReader io.Reader, userAddr, fileName string) err
 		FilePath:  cleanName,
 		CreatedAt: time.Now(),
 		State:     db.FileStateNew,
+		Size:      uint64(written),
+		RequestID: getRequestInfo(ctx).ID,
 	}
 
 	if err := s.db.StoreFileInfo(userAddr, fileData); err != nil {
 		return fmt.Errorf("failed to store file metadata in database: %w", err)
 	}
+	s.publishFileEvent(EventFileAdded, userAddr+":"+cleanName, &fileData)
 
+	ctxLogger(ctx, &s.logger).Debug().Str("addr", userAddr).Str("file", cleanName).Uint64("size", size).Msg("file stored")
 	return nil
 }
 
+func validateFileName(fileName string) (string, error) {
+	if len(fileName) > 1000 {
+		return "", fmt.Errorf("%w: too long", ErrInvalidFileName)
+	}
+
+	cleanName := filepath.Base(filepath.Clean(fileName))
+
+	// Validate the fileName to prevent vulnerabilities like directory traversal.
+	if cleanName == "." || cleanName == "" ||
+		strings.Contains(cleanName, "..") ||
+		strings.ContainsRune(cleanName, os.PathSeparator) {
+		return "", fmt.Errorf("%w: %s", ErrInvalidFileName, fileName)
+	}
+	return cleanName, nil
+}
+
 func (s *Service) doStore() {
+	defer observeCycle("store", time.Now())
+
 	storeList, err := s.db.GetPendingStoreTasks()
 	if err != nil {
 		s.logger.Error().Err(err).Msg("failed to get pending tasks")
 		return
 	}
+	taskQueueDepth.WithLabelValues("store").Set(float64(len(storeList)))
 
 	for _, key := range storeList {
+		if s.stopping() {
+			return
+		}
+
 		fi, err := s.db.GetFileByKey(key)
 		if err != nil {
 			s.logger.Error().Err(err).Str("key", key).Msg("failed to get file data")
 			continue
 		}
 
+		log := s.fileLogger(fi)
 		fullFilePath := filepath.Join(s.storageBaseDir, fi.OwnerAddr, fi.FilePath)
 
-		id, err := s.stg.CreateBag(context.Background(), fullFilePath, fi.FilePath, nil)
-		if err != nil {
-			s.logger.Error().Err(err).Str("key", key).Msg("failed to create bag")
-			continue
+		id := fi.ImportBagID
+		if id == nil {
+			id, err = s.stg.CreateBag(context.Background(), fullFilePath, fi.FilePath, nil)
+			if err != nil {
+				log.Error().Err(err).Str("key", key).Msg("failed to create bag")
+				continue
+			}
 		}
 
 		details, err := s.stg.GetBag(context.Background(), id)
 		if err != nil {
-			s.logger.Error().Err(err).Str("key", key).Msg("failed to get bag details")
+			if fi.ImportBagID != nil && errors.Is(err, storage.ErrNotFound) && time.Since(fi.CreatedAt) > s.freeStore {
+				s.failImport(key, fi, "bag not found")
+				continue
+			}
+			log.Error().Err(err).Str("key", key).Msg("failed to get bag details")
 			continue
 		}
 
+		if fi.ImportBagID != nil && (!details.HeaderLoaded || !details.InfoLoaded) {
+			// imported bag header is still downloading from the network
+			if time.Since(fi.CreatedAt) > s.freeStore {
+				s.failImport(key, fi, "bag header not loaded in time")
+			}
+			continue
+		}
+
+		if fi.ImportBagID != nil {
+			// size of imported bag is known only now, so quota is checked here and not on import
+			if err = s.checkImportSize(fi.OwnerAddr, details.Size+details.HeaderSize); err != nil {
+				if !errors.Is(err, ErrQuotaExceeded) {
+					log.Error().Err(err).Str("key", key).Msg("failed to check import quota")
+					continue
+				}
+				s.failImport(key, fi, err.Error())
+				continue
+			}
+		}
+
 		b := db.Bag{
 			RootHash:   mustHexDecode(details.BagID),
 			MerkleHash: mustHexDecode(details.MerkleHash),
 			FullSize:   details.Size + details.HeaderSize, // TODO: file size not full bag
 			PieceSize:  details.PieceSize,
 			CreatedAt:  time.Now(),
+			Files:      make([]db.BagFile, 0, len(details.Files)),
+		}
+
+		for _, f := range details.Files {
+			b.Files = append(b.Files, db.BagFile{Name: f.Name, Size: f.Size})
 		}
 
 		addr, err := s.calcContractAddr(&b, address.MustParseAddr(fi.OwnerAddr))
 		if err != nil {
-			s.logger.Error().Err(err).Str("key", key).Msg("failed to get contract deploy data")
+			log.Error().Err(err).Str("key", key).Msg("failed to get contract deploy data")
 			continue
 		}
 
 		remove, err := s.db.CompleteStoreTask(key, b, addr.String(), s.freeStore)
 		if err != nil {
-			s.logger.Error().Err(err).Str("key", key).Msg("failed to complete task")
+			log.Error().Err(err).Str("key", key).Msg("failed to complete task")
+		} else {
+			s.publishUpdatedFileEvent(EventBagCreated, key)
 		}
 
-		if remove {
-			if err = os.Remove(fullFilePath); err != nil {
-				s.logger.Error().Err(err).Str("key", key).Msg("failed to remove file")
+		if remove && fi.ImportBagID == nil {
+			rmFunc := os.Remove
+			if fi.Dir {
+				rmFunc = os.RemoveAll
+			}
+
+			if err = rmFunc(fullFilePath); err != nil {
+				log.Error().Err(err).Str("key", key).Msg("failed to remove file")
 			}
 		}
 	}
 }
 
+// fileLogger returns logger with id of the request which added the file, when it is known
+func (s *Service) fileLogger(fi *db.FileInfo) *zerolog.Logger {
+	if fi.RequestID == "" {
+		return &s.logger
+	}
+	l := s.logger.With().Str("request_id", fi.RequestID).Logger()
+	return &l
+}
+
 func (s *Service) doCleanup() {
+	defer observeCycle("cleanup", time.Now())
+
 	list, err := s.db.GetPendingCleanupTasks()
 	if err != nil {
 		s.logger.Error().Err(err).Msg("failed to get pending cleanup tasks")
 		return
 	}
+	taskQueueDepth.WithLabelValues("clean").Set(float64(len(list)))
 
 	for _, t := range list {
+		if s.stopping() {
+			return
+		}
+
 		fi, err := s.db.GetFileByKey(t.Key)
 		if err != nil {
 			s.logger.Error().Err(err).Str("key", t.Key).Msg("failed to get file data")
@@ -388,6 +567,10 @@ func (s *Service) doCleanup() {
 			continue
 		}
 
+		if rm && fi != nil {
+			s.publishFileEvent(EventFileRemoved, t.Key, nil)
+		}
+
 		if del && fi != nil {
 			// we remove after, because remove before is bad, and in case of our fail not so critical
 			if err = s.stg.RemoveBag(context.Background(), fi.Bag.RootHash, true); err != nil {
@@ -395,18 +578,42 @@ func (s *Service) doCleanup() {
 				continue
 			}
 		}
+
+		if rm && fi != nil && fi.Bag == nil && fi.ImportBagID != nil {
+			// import removed before its bag was registered, daemon is still downloading it
+			s.removeImportedBag(t.Key, fi)
+		}
 	}
 }
 
 func (s *Service) doUpdate() {
+	defer observeCycle("update", time.Now())
+
 	list, err := s.db.GetPendingUpdateTasks()
 	if err != nil {
 		s.logger.Error().Err(err).Msg("failed to get pending update tasks")
 		return
 	}
+	taskQueueDepth.WithLabelValues("update").Set(float64(len(list)))
+
+	type fileEvent struct {
+		typ, key string
+	}
+
+	type expiryAlert struct {
+		settings *db.NotifySettings
+		alert    ExpiryAlert
+	}
 
 	var toUpd []db.UpdateTaskResult
+	var events []fileEvent
+	var alerts []expiryAlert
 	for _, task := range list {
+		if s.stopping() {
+			// save what is already processed
+			break
+		}
+
 		func() {
 			nextAt := time.Now().Add(time.Second * 15)
 			res := db.UpdateTaskResult{
@@ -458,7 +665,7 @@ func (s *Service) doUpdate() {
 			}
 
 			ctx, cancel := context.WithTimeout(context.Background(), 7*time.Second)
-			balance, toProof, perDay, left, err := s.fetchContractInfo(ctx, fi.Bag, address.MustParseAddr(fi.OwnerAddr), s.providerKey)
+			balance, providers, err := s.fetchContractInfo(ctx, fi.Bag, address.MustParseAddr(fi.OwnerAddr))
 			cancel()
 			if err != nil {
 				if errors.Is(err, contract.ErrProviderNotFound) || errors.Is(err, contract.ErrNotDeployed) {
@@ -478,58 +685,142 @@ func (s *Service) doUpdate() {
 
 					return
 				}
+				chainFailures.WithLabelValues("fetch_contract_info").Inc()
 				s.logger.Debug().Err(err).Str("key", res.Key).Msg("failed to get contract info")
 				return
 			}
-			s.logger.Debug().Str("key", res.Key).Time("at", res.ExecAt).Msgf("contract fetched, balance: %s", balance.String())
+			s.logger.Debug().Str("key", res.Key).Time("at", res.ExecAt).Int("providers", len(providers)).Msgf("contract fetched, balance: %s", balance.String())
+
+			contractAddr := address.MustParseAddr(fi.ContractAddr)
+			perDay := new(big.Int)
+			states := make([]db.ProviderState, 0, len(providers))
+			reached := 0
+			for _, p := range providers {
+				perDay.Add(perDay, p.PerDay.Nano())
+
+				st := db.ProviderState{
+					Key:       p.Key,
+					Balance:   p.Share.String(),
+					PerDay:    p.PerDay.String(),
+					Left:      p.Left,
+					PaidUntil: p.PaidUntil,
+				}
 
-			ctx, cancel = context.WithTimeout(context.Background(), 7*time.Second)
-			info, err := s.provider.RequestStorageInfo(ctx, s.providerKey, address.MustParseAddr(fi.ContractAddr), toProof)
-			cancel()
-			if err != nil {
-				s.logger.Warn().Err(err).Str("key", res.Key).Msg("failed to get storage info")
-				return
-			}
+				last := s.lastProviderState(fi.Provider, p.Key)
+				if last != nil {
+					st.Status, st.Reason, st.ErrorSince = last.Status, last.Reason, last.ErrorSince
+				}
 
-			var errorSince *time.Time
-			if info.Status == "error" {
-				if info.Reason != "internal provider error" {
-					if fi.Provider != nil && fi.Provider.ErrorSince != nil && time.Since(*fi.Provider.ErrorSince) > s.freeStore {
-						s.logger.Debug().Str("key", res.Key).Msg("provider is not agrees, removing")
-						if err = s.db.CreateCleanTaskByKey(res.Key); err != nil {
-							s.logger.Error().Err(err).Str("key", res.Key).Msg("failed to create clean task")
+				ctx, cancel = context.WithTimeout(context.Background(), 7*time.Second)
+				info, err := s.provider.RequestStorageInfo(ctx, p.Key, contractAddr, p.ByteToProof)
+				cancel()
+				if err != nil {
+					chainFailures.WithLabelValues("request_storage_info").Inc()
+					s.logger.Warn().Err(err).Str("key", res.Key).Hex("provider", p.Key).Msg("failed to get storage info")
+					st.Error = err.Error()
+					states = append(states, st)
+					continue
+				}
+				reached++
+
+				st.Status, st.Reason, st.ErrorSince = info.Status, info.Reason, nil
+				if info.Status == "error" {
+					if info.Reason != "internal provider error" {
+						if last != nil && last.ErrorSince != nil {
+							st.ErrorSince = last.ErrorSince
+						} else {
+							tm := time.Now()
+							st.ErrorSince = &tm
 						}
-						res.NextExecAt = nil
-						return
 					}
 
-					if fi.Provider != nil && fi.Provider.ErrorSince != nil {
-						errorSince = fi.Provider.ErrorSince
-					} else {
-						tm := time.Now()
-						errorSince = &tm
+					snc := time.Now()
+					if st.ErrorSince != nil {
+						snc = *st.ErrorSince
 					}
+
+					s.logger.Warn().Str("key", res.Key).Hex("provider", p.Key).Str("for", time.Since(snc).String()).Str("reason", info.Reason).Msg("provider error")
 				}
+				states = append(states, st)
+			}
 
-				snc := time.Now()
-				if errorSince != nil {
-					snc = *errorSince
+			if reached == 0 {
+				// keep previous info until at least one provider answers
+				return
+			}
+
+			status, reason, errorSince := aggregateProviderStatus(states)
+			if errorSince != nil && time.Since(*errorSince) > s.freeStore {
+				s.logger.Debug().Str("key", res.Key).Msg("providers are not agree, removing")
+				if err = s.db.CreateCleanTaskByKey(res.Key); err != nil {
+					s.logger.Error().Err(err).Str("key", res.Key).Msg("failed to create clean task")
 				}
+				res.NextExecAt = nil
+				return
+			}
 
-				s.logger.Warn().Str("key", res.Key).Str("for", time.Since(snc).String()).Str("reason", info.Reason).Msg("provider error")
+			// the one which runs out first defines time left of the file
+			first := states[0]
+			for _, st := range states[1:] {
+				if st.PaidUntil.Before(first.PaidUntil) {
+					first = st
+				}
 			}
 
 			nextAt = time.Now().Add(time.Minute * 5)
 			res.NextExecAt = &nextAt
 
 			res.ProviderInfo = &db.ProviderInfo{
-				PerDay:      perDay.String(),
+				PerDay:      tlb.FromNanoTON(perDay).String(),
 				Balance:     balance.String(),
-				Status:      info.Status,
-				Reason:      info.Reason,
+				Status:      status,
+				Reason:      reason,
 				LastUpdated: time.Now(),
 				ErrorSince:  errorSince,
-				Left:        left,
+				Left:        first.Left,
+				PaidUntil:   first.PaidUntil,
+				Providers:   states,
+			}
+
+			if fi.Provider != nil {
+				res.ProviderInfo.AlertedDays = fi.Provider.AlertedDays
+			}
+
+			settings, err := s.db.GetNotifySettings(fi.OwnerAddr)
+			if err != nil {
+				s.logger.Error().Err(err).Str("key", res.Key).Msg("failed to get notify settings")
+			} else {
+				var notify bool
+				res.ProviderInfo.AlertedDays, notify = checkExpiry(settings, res.ProviderInfo.AlertedDays, first.PaidUntil)
+				if notify {
+					alerts = append(alerts, expiryAlert{settings, ExpiryAlert{
+						Event:         NotifyExpiry,
+						UserAddr:      fi.OwnerAddr,
+						FileName:      fi.FilePath,
+						BagID:         hex.EncodeToString(fi.Bag.RootHash),
+						ContractAddr:  fi.ContractAddr,
+						ThresholdDays: res.ProviderInfo.AlertedDays,
+						TimeLeft:      first.Left,
+						ExpireAt:      first.PaidUntil,
+						Balance:       res.ProviderInfo.Balance,
+						PerDay:        res.ProviderInfo.PerDay,
+						At:            time.Now(),
+					}})
+				}
+			}
+
+			switch {
+			case fi.State < db.FileStateStored || fi.Provider == nil:
+				events = append(events, fileEvent{EventContractDeployed, res.Key})
+			case fi.Provider.Status != status || fi.Provider.Reason != reason || providerStatusChanged(fi.Provider.Providers, states):
+				events = append(events, fileEvent{EventProviderStatus, res.Key})
+			case fi.Provider.Balance != res.ProviderInfo.Balance:
+				events = append(events, fileEvent{EventBalance, res.Key})
+			}
+
+			// checked apart from the switch, provider can fail already on the first update after deploy
+			if status == StatusError && (fi.Provider == nil || fi.Provider.Status != StatusError) {
+				events = append(events, fileEvent{EventProviderError, res.Key})
 			}
 		}()
 	}
@@ -538,20 +829,150 @@ func (s *Service) doUpdate() {
 		s.logger.Error().Err(err).Msg("failed to complete update tasks")
 		return
 	}
+
+	for _, ev := range events {
+		s.publishUpdatedFileEvent(ev.typ, ev.key)
+	}
+
+	for _, a := range alerts {
+		if err = s.queueNotification(a.settings, a.alert); err != nil {
+			s.logger.Error().Err(err).Str("addr", a.alert.UserAddr).Str("file", a.alert.FileName).Msg("failed to queue expiry alert")
+		}
+	}
+}
+
+// lastProviderState returns state of the provider from the previous update,
+// files updated before replication have only aggregated state of the primary provider
+func (s *Service) lastProviderState(info *db.ProviderInfo, key []byte) *db.ProviderState {
+	if info == nil {
+		return nil
+	}
+
+	for i := range info.Providers {
+		if bytes.Equal(info.Providers[i].Key, key) {
+			return &info.Providers[i]
+		}
+	}
+
+	if len(info.Providers) == 0 && bytes.Equal(key, s.providerKey) {
+		return &db.ProviderState{Status: info.Status, Reason: info.Reason, ErrorSince: info.ErrorSince}
+	}
+	return nil
+}
+
+// aggregateProviderStatus returns status of the first provider which is not in error, file is considered failed
+// only when all providers are in error, errorSince is when the last of them failed
+func aggregateProviderStatus(states []db.ProviderState) (string, string, *time.Time) {
+	for _, st := range states {
+		if st.Status != StatusError && st.Status != "" {
+			return st.Status, st.Reason, nil
+		}
+	}
+
+	var errorSince *time.Time
+	for _, st := range states {
+		if st.ErrorSince == nil {
+			// internal error or not reachable provider, not counted as failure
+			return StatusError, st.Reason, nil
+		}
+		if errorSince == nil || st.ErrorSince.After(*errorSince) {
+			errorSince = st.ErrorSince
+		}
+	}
+	return StatusError, states[0].Reason, errorSince
+}
+
+func providerStatusChanged(old, cur []db.ProviderState) bool {
+	if len(old) != len(cur) {
+		return true
+	}
+	for i := range cur {
+		if !bytes.Equal(old[i].Key, cur[i].Key) || old[i].Status != cur[i].Status || old[i].Reason != cur[i].Reason {
+			return true
+		}
+	}
+	return false
 }
 
-func (s *Service) worker() {
-	ticker := time.NewTicker(500 * time.Millisecond)
+// Stop signals worker to stop and waits until it finishes the current task
+func (s *Service) Stop(ctx context.Context) error {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+
+	select {
+	case <-s.workerDone:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Service) stopping() bool {
+	select {
+	case <-s.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// startWorkers runs background loops, workerDone is closed when all of them are stopped.
+// Delivery of notifications and providers polling go to remote hosts, so they have own loops, to not stall file processing
+func (s *Service) startWorkers() {
+	var wg sync.WaitGroup
+	run := func(name string, interval time.Duration, fn func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.loop(name, interval, fn)
+		}()
+	}
+
+	run("files", 500*time.Millisecond, func() {
+		s.doStore()
+		s.doCleanup()
+		s.doUpdate()
+		s.doExpireUploads()
+	})
+	run("notify", 500*time.Millisecond, s.doNotify)
+	// polling is throttled by itself, short tick only lets newly added provider be polled soon
+	run("providers", 500*time.Millisecond, s.doPollProviders)
+	if s.telegram.BotToken != "" {
+		run("telegram", telegramPollInterval, s.doTelegramUpdates)
+	}
+
+	go func() {
+		wg.Wait()
+		close(s.workerDone)
+	}()
+}
+
+// loop calls fn every interval until service is stopped
+func (s *Service) loop(name string, interval time.Duration, fn func()) {
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
 		select {
+		case <-s.stop:
+			s.logger.Info().Str("loop", name).Msg("worker stopped")
+			return
 		case <-ticker.C:
-			s.doStore()
-			s.doCleanup()
-			s.doUpdate()
+			fn()
+		}
+	}
+}
+
+// NormalizeAddress parses raw or user-friendly address and returns it in the same form as used for user keys
+func NormalizeAddress(addr string) (string, error) {
+	a, err := address.ParseAddr(addr)
+	if err != nil {
+		if a, err = address.ParseRawAddr(addr); err != nil {
+			return "", fmt.Errorf("invalid address: %w", err)
 		}
 	}
+	return address.NewAddress(0, byte(a.Workchain()), a.Data()).String(), nil
 }
 
 func mustHexDecode(s string) []byte {
@@ -0,0 +1,137 @@
+package backend
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/xssnick/ton-provider-web/internal/backend/db"
+	"github.com/xssnick/tonutils-go/address"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const sessionCookieName = "session"
+
+var ErrSessionInvalid = errors.New("invalid session")
+
+// CreateSession stores new session of the user, domain is the TON Connect domain which proof was issued for
+func (s *Service) CreateSession(userAddr, domain string, ttl time.Duration) (*db.Session, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate session id: %w", err)
+	}
+
+	now := time.Now()
+	session := db.Session{
+		ID:        hex.EncodeToString(id),
+		OwnerAddr: userAddr,
+		Domain:    domain,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+
+	if err := s.db.CreateSession(session); err != nil {
+		return nil, fmt.Errorf("failed to store session: %w", err)
+	}
+	return &session, nil
+}
+
+func (s *Service) GetSession(userAddr, id string) (*db.Session, error) {
+	return s.db.GetSession(userAddr, id)
+}
+
+func (s *Service) RevokeSession(userAddr, id string) error {
+	return s.db.RevokeSession(userAddr, id)
+}
+
+func (s *Service) RevokeAllSessions(userAddr string) (int, error) {
+	return s.db.RevokeAllSessions(userAddr)
+}
+
+// sessionCookie builds signed cookie value in format signature:id:expire:address
+func (s *Server) sessionCookie(session *db.Session) *http.Cookie {
+	sessionData := fmt.Sprintf("%s:%d:%s", session.ID, session.ExpiresAt.Unix(), session.OwnerAddr)
+	signature := ed25519.Sign(s.key, []byte(sessionData))
+
+	return &http.Cookie{
+		Name:     sessionCookieName,
+		Path:     "/api/v1",
+		HttpOnly: true,
+		Value:    fmt.Sprintf("%x:%s", signature, sessionData),
+		Expires:  session.ExpiresAt,
+		SameSite: http.SameSiteStrictMode,
+	}
+}
+
+func (s *Server) clearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Path:     "/api/v1",
+		HttpOnly: true,
+		Value:    "",
+		MaxAge:   -1,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// checkSession verifies cookie signature and expiration, and makes sure session was not revoked
+func (s *Server) checkSession(r *http.Request) (*db.Session, *address.Address, error) {
+	id, addr, err := s.parseSessionCookie(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	session, err := s.svc.GetSession(addr.String(), id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	if session == nil {
+		return nil, nil, fmt.Errorf("%w: revoked", ErrSessionInvalid)
+	}
+
+	// sessions of the domain which was removed from config are not valid anymore
+	if session.Domain != "" && s.verifiers[session.Domain] == nil {
+		return nil, nil, fmt.Errorf("%w: domain %s is not allowed", ErrSessionInvalid, session.Domain)
+	}
+
+	return session, addr, nil
+}
+
+// parseSessionCookie verifies only cookie signature and expiration, without db lookup, and returns session id and owner
+func (s *Server) parseSessionCookie(r *http.Request) (string, *address.Address, error) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil || cookie.Value == "" {
+		return "", nil, ErrSessionInvalid
+	}
+
+	signature, sessionData, ok := strings.Cut(cookie.Value, ":")
+	if !ok {
+		return "", nil, fmt.Errorf("%w: bad format", ErrSessionInvalid)
+	}
+
+	sigBytes, err := hex.DecodeString(signature)
+	if err != nil || !ed25519.Verify(s.key.Public().(ed25519.PublicKey), []byte(sessionData), sigBytes) {
+		return "", nil, fmt.Errorf("%w: bad signature", ErrSessionInvalid)
+	}
+
+	dataParts := strings.SplitN(sessionData, ":", 3)
+	if len(dataParts) != 3 {
+		return "", nil, fmt.Errorf("%w: bad data format", ErrSessionInvalid)
+	}
+
+	expireAt, err := strconv.ParseInt(dataParts[1], 10, 64)
+	if err != nil || time.Now().Unix() >= expireAt {
+		return "", nil, fmt.Errorf("%w: expired", ErrSessionInvalid)
+	}
+
+	addr, err := address.ParseAddr(dataParts[2])
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: bad address", ErrSessionInvalid)
+	}
+
+	return dataParts[0], addr, nil
+}
@@ -0,0 +1,190 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/xssnick/ton-provider-web/internal/backend/db"
+	"os"
+	"time"
+)
+
+var (
+	ErrShareLinkNotFound = errors.New("share link not found")
+	ErrShareLinkPassword = errors.New("share link password is incorrect")
+)
+
+type ShareLinkParams struct {
+	FileName     string `json:"file_name"`
+	ExpiresInSec uint64 `json:"expires_in_sec"`
+	MaxDownloads uint64 `json:"max_downloads"`
+	Password     string `json:"password"`
+}
+
+type ShareLinkInfo struct {
+	ID           string     `json:"id"`
+	FileName     string     `json:"file_name"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	MaxDownloads uint64     `json:"max_downloads"`
+	Downloads    uint64     `json:"downloads"`
+	HasPassword  bool       `json:"has_password"`
+	Active       bool       `json:"active"`
+}
+
+func toShareLinkInfo(link *db.ShareLink) ShareLinkInfo {
+	return ShareLinkInfo{
+		ID:           link.ID,
+		FileName:     link.FileName,
+		CreatedAt:    link.CreatedAt,
+		ExpiresAt:    link.ExpiresAt,
+		MaxDownloads: link.MaxDownloads,
+		Downloads:    link.Downloads,
+		HasPassword:  len(link.PasswordHash) > 0,
+		Active:       link.Active(),
+	}
+}
+
+func (s *Service) CreateShareLink(userAddr string, params ShareLinkParams) (*ShareLinkInfo, error) {
+	fi, err := s.db.GetFile(userAddr, params.FileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+	if fi == nil {
+		return nil, ErrFileNotFound
+	}
+	if fi.Bag == nil {
+		return nil, ErrBagNotReady
+	}
+
+	id := make([]byte, 16)
+	if _, err = rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate link id: %w", err)
+	}
+
+	link := db.ShareLink{
+		ID:           hex.EncodeToString(id),
+		OwnerAddr:    userAddr,
+		FileName:     params.FileName,
+		BagID:        fi.Bag.RootHash,
+		CreatedAt:    time.Now(),
+		MaxDownloads: params.MaxDownloads,
+	}
+
+	if params.ExpiresInSec > 0 {
+		at := link.CreatedAt.Add(time.Duration(params.ExpiresInSec) * time.Second)
+		link.ExpiresAt = &at
+	}
+
+	if params.Password != "" {
+		link.PasswordSalt = make([]byte, 16)
+		if _, err = rand.Read(link.PasswordSalt); err != nil {
+			return nil, fmt.Errorf("failed to generate salt: %w", err)
+		}
+
+		if link.PasswordHash, err = hashSharePassword(params.Password, link.PasswordSalt); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = s.db.CreateShareLink(link); err != nil {
+		return nil, fmt.Errorf("failed to store share link: %w", err)
+	}
+
+	info := toShareLinkInfo(&link)
+	return &info, nil
+}
+
+// ListShareLinks returns share links of the user, filtered by file when fileName is not empty
+func (s *Service) ListShareLinks(userAddr, fileName string) ([]ShareLinkInfo, error) {
+	links, err := s.db.GetShareLinksByUser(userAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get share links: %w", err)
+	}
+
+	list := make([]ShareLinkInfo, 0, len(links))
+	for i := range links {
+		if fileName != "" && links[i].FileName != fileName {
+			continue
+		}
+		list = append(list, toShareLinkInfo(&links[i]))
+	}
+	return list, nil
+}
+
+func (s *Service) RevokeShareLink(userAddr, id string) error {
+	link, err := s.db.GetShareLink(id)
+	if err != nil {
+		return fmt.Errorf("failed to get share link: %w", err)
+	}
+	if link == nil || link.OwnerAddr != userAddr {
+		return ErrShareLinkNotFound
+	}
+
+	if err = s.db.DeleteShareLink(userAddr, id); err != nil {
+		return fmt.Errorf("failed to delete share link: %w", err)
+	}
+	return nil
+}
+
+// OpenSharedFile opens bag file referenced by share link, when count is true download is counted against the link limit
+func (s *Service) OpenSharedFile(ctx context.Context, id, password, innerPath string, count bool) (*os.File, string, error) {
+	link, err := s.db.GetShareLink(id)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get share link: %w", err)
+	}
+	if link == nil {
+		return nil, "", ErrShareLinkNotFound
+	}
+	if !link.Active() {
+		return nil, "", db.ErrShareLinkExhausted
+	}
+
+	if len(link.PasswordHash) > 0 {
+		hash, err := hashSharePassword(password, link.PasswordSalt)
+		if err != nil {
+			return nil, "", err
+		}
+
+		if subtle.ConstantTimeCompare(hash, link.PasswordHash) != 1 {
+			return nil, "", ErrShareLinkPassword
+		}
+	}
+
+	fi, err := s.db.GetFile(link.OwnerAddr, link.FileName)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get file info: %w", err)
+	}
+	// file could be removed and uploaded again with the same name, link is bound to the bag
+	if fi == nil || fi.Bag == nil || !bytes.Equal(fi.Bag.RootHash, link.BagID) {
+		return nil, "", ErrFileNotFound
+	}
+
+	f, name, err := s.openFile(ctx, fi, innerPath)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if count {
+		if err = s.db.UseShareLink(id); err != nil {
+			_ = f.Close()
+			return nil, "", err
+		}
+	}
+
+	return f, name, nil
+}
+
+func hashSharePassword(password string, salt []byte) ([]byte, error) {
+	hash, err := pbkdf2.Key(sha256.New, password, salt, 100000, 32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+	return hash, nil
+}
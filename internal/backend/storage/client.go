@@ -7,8 +7,11 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/rs/zerolog"
 	"net/http"
+	"strings"
 )
 
 type Client struct {
@@ -26,6 +29,13 @@ type Credentials struct {
 
 var ErrNotFound = errors.New("not found")
 
+var requestFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "ton_provider_web",
+	Subsystem: "storage",
+	Name:      "request_failures_total",
+	Help:      "Number of failed requests to storage daemon by api path.",
+}, []string{"path"})
+
 func NewClient(base string, credentials *Credentials, logger zerolog.Logger) *Client {
 	return &Client{
 		base:        base,
@@ -84,6 +94,32 @@ func (c *Client) CreateBag(ctx context.Context, path, description string, only [
 	return bagId, nil
 }
 
+// AddBag starts download of existing bag from the network into the given directory
+func (c *Client) AddBag(ctx context.Context, bagId []byte, path string, downloadAll bool) error {
+	c.logger.Info().Hex("id", bagId).Str("path", path).Msg("adding bag")
+
+	type request struct {
+		BagID       string   `json:"bag_id"`
+		Path        string   `json:"path"`
+		Files       []uint32 `json:"files"`
+		DownloadAll bool     `json:"download_all"`
+	}
+
+	var res Result
+	if err := c.doRequest(ctx, "POST", "/api/v1/add", request{
+		BagID:       hex.EncodeToString(bagId),
+		Path:        path,
+		DownloadAll: downloadAll,
+	}, &res); err != nil {
+		return fmt.Errorf("failed to do request: %w", err)
+	}
+
+	if !res.Ok {
+		return fmt.Errorf("error in response: %s", res.Error)
+	}
+	return nil
+}
+
 func (c *Client) ListBags(ctx context.Context) ([]Bag, error) {
 	type response struct {
 		Bags []Bag `json:"bags"`
@@ -118,6 +154,15 @@ func (c *Client) RemoveBag(ctx context.Context, bagId []byte, withFiles bool) er
 }
 
 func (c *Client) doRequest(ctx context.Context, method, url string, req, resp any) error {
+	err := c.request(ctx, method, url, req, resp)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		path, _, _ := strings.Cut(url, "?")
+		requestFailures.WithLabelValues(path).Inc()
+	}
+	return err
+}
+
+func (c *Client) request(ctx context.Context, method, url string, req, resp any) error {
 	buf := &bytes.Buffer{}
 	if req != nil {
 		if err := json.NewEncoder(buf).Encode(req); err != nil {
@@ -0,0 +1,222 @@
+package backend
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/xssnick/ton-provider-web/internal/backend/db"
+	"github.com/xssnick/tonutils-go/address"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	ScopeUpload     = "upload"
+	ScopeList       = "list"
+	ScopeRemove     = "remove"
+	ScopeDeployData = "deploy-data"
+
+	// scopeSessionOnly marks routes which are not available with api tokens
+	scopeSessionOnly = ""
+)
+
+const (
+	tokenPrefix        = "tpw_"
+	tokenTouchInterval = time.Minute
+	maxTokensPerUser   = 20
+)
+
+var allScopes = []string{ScopeUpload, ScopeList, ScopeRemove, ScopeDeployData}
+
+var (
+	ErrTokenInvalid  = errors.New("invalid api token")
+	ErrTokenScope    = errors.New("api token has no required scope")
+	ErrTokenNotFound = errors.New("api token not found")
+)
+
+type TokenParams struct {
+	Name         string   `json:"name"`
+	Scopes       []string `json:"scopes"`
+	ExpiresInSec uint64   `json:"expires_in_sec"`
+}
+
+type TokenInfo struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+
+	// Token is returned only once, on creation
+	Token string `json:"token,omitempty"`
+}
+
+func toTokenInfo(token *db.APIToken) TokenInfo {
+	return TokenInfo{
+		ID:         token.ID,
+		Name:       token.Name,
+		Scopes:     token.Scopes,
+		CreatedAt:  token.CreatedAt,
+		ExpiresAt:  token.ExpiresAt,
+		LastUsedAt: token.LastUsedAt,
+	}
+}
+
+func (s *Service) CreateAPIToken(userAddr string, params TokenParams) (*TokenInfo, error) {
+	if params.Name == "" || len(params.Name) > 100 {
+		return nil, fmt.Errorf("%w: token name should be from 1 to 100 characters", ErrInvalidInput)
+	}
+
+	if len(params.Scopes) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidInput)
+	}
+	for _, scope := range params.Scopes {
+		if !slices.Contains(allScopes, scope) {
+			return nil, fmt.Errorf("%w: unknown scope %s", ErrInvalidInput, scope)
+		}
+	}
+
+	existing, err := s.db.GetAPITokensByUser(userAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tokens: %w", err)
+	}
+	if len(existing) >= maxTokensPerUser {
+		return nil, fmt.Errorf("%w: too many tokens, revoke unused first", ErrQuotaExceeded)
+	}
+
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+	if _, err = rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate token id: %w", err)
+	}
+	if _, err = rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	plain := tokenPrefix + hex.EncodeToString(id) + "_" + base64.RawURLEncoding.EncodeToString(secret)
+
+	token := db.APIToken{
+		ID:        hex.EncodeToString(id),
+		OwnerAddr: userAddr,
+		Name:      params.Name,
+		Scopes:    slices.Compact(slices.Sorted(slices.Values(params.Scopes))),
+		Hash:      hashToken(plain),
+		CreatedAt: time.Now(),
+	}
+
+	if params.ExpiresInSec > 0 {
+		at := token.CreatedAt.Add(time.Duration(params.ExpiresInSec) * time.Second)
+		token.ExpiresAt = &at
+	}
+
+	if err = s.db.CreateAPIToken(token); err != nil {
+		return nil, fmt.Errorf("failed to store token: %w", err)
+	}
+
+	info := toTokenInfo(&token)
+	info.Token = plain
+	return &info, nil
+}
+
+func (s *Service) ListAPITokens(userAddr string) ([]TokenInfo, error) {
+	tokens, err := s.db.GetAPITokensByUser(userAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tokens: %w", err)
+	}
+
+	list := make([]TokenInfo, 0, len(tokens))
+	for i := range tokens {
+		list = append(list, toTokenInfo(&tokens[i]))
+	}
+	return list, nil
+}
+
+func (s *Service) RevokeAPIToken(userAddr, id string) error {
+	found, err := s.db.DeleteAPIToken(userAddr, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete token: %w", err)
+	}
+	if !found {
+		return ErrTokenNotFound
+	}
+	return nil
+}
+
+// CheckAPIToken finds token, verifies its expiration and scope, and records its usage
+func (s *Service) CheckAPIToken(plain, scope string) (*db.APIToken, error) {
+	if !strings.HasPrefix(plain, tokenPrefix) {
+		return nil, ErrTokenInvalid
+	}
+
+	hash := hashToken(plain)
+	token, err := s.db.GetAPITokenByHash(hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get token: %w", err)
+	}
+	if token == nil {
+		return nil, ErrTokenInvalid
+	}
+
+	if token.ExpiresAt != nil && time.Now().After(*token.ExpiresAt) {
+		return nil, fmt.Errorf("%w: expired", ErrTokenInvalid)
+	}
+
+	if scope == scopeSessionOnly || !slices.Contains(token.Scopes, scope) {
+		return nil, ErrTokenScope
+	}
+
+	// to not write on each request
+	if token.LastUsedAt == nil || time.Since(*token.LastUsedAt) > tokenTouchInterval {
+		if err = s.db.TouchAPIToken(hash, time.Now()); err != nil {
+			s.logger.Warn().Err(err).Str("id", token.ID).Msg("failed to update token usage time")
+		}
+	}
+
+	return token, nil
+}
+
+// APITokenOwner returns owner of the not expired token, without scope check and usage tracking
+func (s *Service) APITokenOwner(plain string) (string, error) {
+	if !strings.HasPrefix(plain, tokenPrefix) {
+		return "", ErrTokenInvalid
+	}
+
+	token, err := s.db.GetAPITokenByHash(hashToken(plain))
+	if err != nil {
+		return "", fmt.Errorf("failed to get token: %w", err)
+	}
+	if token == nil || (token.ExpiresAt != nil && time.Now().After(*token.ExpiresAt)) {
+		return "", ErrTokenInvalid
+	}
+	return token.OwnerAddr, nil
+}
+
+// checkToken authorizes request with 'Authorization: Bearer' header
+func (s *Server) checkToken(r *http.Request, scope string) (*address.Address, error) {
+	plain, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return nil, ErrTokenInvalid
+	}
+
+	token, err := s.svc.CheckAPIToken(strings.TrimSpace(plain), scope)
+	if err != nil {
+		return nil, err
+	}
+
+	addr, err := address.ParseAddr(token.OwnerAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse token owner address: %w", err)
+	}
+	return addr, nil
+}
+
+func hashToken(plain string) string {
+	hash := sha256.Sum256([]byte(plain))
+	return hex.EncodeToString(hash[:])
+}
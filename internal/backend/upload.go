@@ -0,0 +1,323 @@
+package backend
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/xssnick/ton-provider-web/internal/backend/db"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// uploadTTL is how long not completed upload is kept after the last received chunk
+const uploadTTL = 1 * time.Hour
+
+var (
+	ErrUploadNotFound       = errors.New("upload not found")
+	ErrUploadOffsetMismatch = errors.New("upload offset mismatch")
+	ErrUploadBusy           = errors.New("upload is busy with another request")
+)
+
+type UploadStatus struct {
+	ID        string    `json:"id"`
+	FileName  string    `json:"file_name"`
+	Size      uint64    `json:"size"`
+	Offset    uint64    `json:"offset"`
+	Completed bool      `json:"completed"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func toUploadStatus(upload *db.Upload) *UploadStatus {
+	return &UploadStatus{
+		ID:        upload.ID,
+		FileName:  upload.FileName,
+		Size:      upload.Size,
+		Offset:    upload.Offset,
+		Completed: upload.Offset == upload.Size,
+		ExpiresAt: upload.ExpiresAt,
+	}
+}
+
+func (s *Service) CreateUpload(ctx context.Context, userAddr, fileName string, size uint64) (*UploadStatus, error) {
+	if size == 0 {
+		return nil, fmt.Errorf("%w: file is empty", ErrInvalidInput)
+	}
+
+	cleanName, err := validateFileName(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	existingFile, err := s.db.GetFile(userAddr, cleanName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check file existence: %w", err)
+	}
+	if existingFile != nil {
+		return nil, fmt.Errorf("%w, remove it first before upload new", ErrFileExists)
+	}
+
+	uploads, err := s.db.GetUploadsByUser(userAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve uploads: %w", err)
+	}
+	for _, upload := range uploads {
+		if upload.FileName == cleanName {
+			return nil, fmt.Errorf("%w: file with the same name is already uploading", ErrFileExists)
+		}
+	}
+
+	if err = s.checkQuota(userAddr, size); err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 16)
+	if _, err = rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate upload id: %w", err)
+	}
+
+	upload := db.Upload{
+		ID:        hex.EncodeToString(id),
+		OwnerAddr: userAddr,
+		FileName:  cleanName,
+		Size:      size,
+		CreatedAt: time.Now(),
+		ExpiresAt: time.Now().Add(uploadTTL),
+	}
+
+	if err = os.MkdirAll(s.uploadsDir(), os.ModePerm); err != nil {
+		return nil, fmt.Errorf("failed to create uploads directory: %w", err)
+	}
+
+	file, err := os.Create(s.uploadPath(upload.ID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file on disk: %w", err)
+	}
+	_ = file.Close()
+
+	if err = s.db.StoreUpload(upload); err != nil {
+		_ = os.Remove(s.uploadPath(upload.ID))
+		return nil, fmt.Errorf("failed to store upload in database: %w", err)
+	}
+
+	ctxLogger(ctx, &s.logger).Debug().Str("id", upload.ID).Str("addr", userAddr).Str("file", cleanName).Uint64("size", size).Msg("upload created")
+	return toUploadStatus(&upload), nil
+}
+
+func (s *Service) GetUpload(userAddr, id string) (*UploadStatus, error) {
+	upload, err := s.db.GetUpload(userAddr, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get upload: %w", err)
+	}
+	if upload == nil {
+		return nil, ErrUploadNotFound
+	}
+	return toUploadStatus(upload), nil
+}
+
+// WriteUploadChunk appends data at offset, offset must be equal to the already received size.
+// Received part is persisted even if reader fails in the middle, so client can resume from the reported offset.
+// When the last byte is received, upload is converted to the file and store task is created.
+func (s *Service) WriteUploadChunk(ctx context.Context, userAddr, id string, offset uint64, r io.Reader) (*UploadStatus, error) {
+	upload, unlock, err := s.lockUpload(userAddr, id)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if offset != upload.Offset {
+		return toUploadStatus(upload), fmt.Errorf("%w: expected %d", ErrUploadOffsetMismatch, upload.Offset)
+	}
+
+	if upload.Offset == upload.Size {
+		// completed earlier, but failed to finalize
+		return toUploadStatus(upload), s.finalizeUpload(ctx, upload)
+	}
+
+	file, err := os.OpenFile(s.uploadPath(upload.ID), os.O_WRONLY, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open file on disk: %w", err)
+	}
+	defer file.Close()
+
+	// drop data which was possibly written but not committed to db
+	if err = file.Truncate(int64(upload.Offset)); err != nil {
+		return nil, fmt.Errorf("failed to truncate file on disk: %w", err)
+	}
+	if _, err = file.Seek(int64(upload.Offset), io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek file on disk: %w", err)
+	}
+
+	n, copyErr := io.Copy(file, io.LimitReader(r, int64(upload.Size-upload.Offset)))
+	if copyErr == nil {
+		// check that chunk is not bigger than declared size
+		if m, _ := r.Read(make([]byte, 1)); m > 0 {
+			copyErr = fmt.Errorf("%w: data exceeds declared file size", ErrInvalidInput)
+		}
+	}
+
+	if err = file.Sync(); err != nil {
+		return nil, fmt.Errorf("failed to sync file on disk: %w", err)
+	}
+
+	upload.Offset += uint64(n)
+	upload.ExpiresAt = time.Now().Add(uploadTTL)
+	if err = s.db.StoreUpload(*upload); err != nil {
+		return nil, fmt.Errorf("failed to store upload in database: %w", err)
+	}
+
+	if copyErr != nil {
+		return toUploadStatus(upload), fmt.Errorf("failed to receive chunk: %w", copyErr)
+	}
+
+	if upload.Offset == upload.Size {
+		if err = s.finalizeUpload(ctx, upload); err != nil {
+			return toUploadStatus(upload), err
+		}
+	}
+	return toUploadStatus(upload), nil
+}
+
+func (s *Service) CancelUpload(ctx context.Context, userAddr, id string) error {
+	upload, unlock, err := s.lockUpload(userAddr, id)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err = s.removeUpload(upload); err != nil {
+		return err
+	}
+
+	ctxLogger(ctx, &s.logger).Debug().Str("id", upload.ID).Str("addr", userAddr).Msg("upload canceled")
+	return nil
+}
+
+func (s *Service) finalizeUpload(ctx context.Context, upload *db.Upload) error {
+	if err := os.MkdirAll(filepath.Join(s.storageBaseDir, upload.OwnerAddr), os.ModePerm); err != nil {
+		return err
+	}
+
+	existingFile, err := s.db.GetFile(upload.OwnerAddr, upload.FileName)
+	if err != nil {
+		return fmt.Errorf("failed to check file existence: %w", err)
+	}
+	if existingFile != nil {
+		return fmt.Errorf("%w, remove it first or cancel upload", ErrFileExists)
+	}
+
+	fullFilePath := filepath.Join(s.storageBaseDir, upload.OwnerAddr, upload.FileName)
+	if err = os.Rename(s.uploadPath(upload.ID), fullFilePath); err != nil {
+		return fmt.Errorf("failed to move uploaded file: %w", err)
+	}
+
+	fileData := db.FileInfo{
+		OwnerAddr: upload.OwnerAddr,
+		FilePath:  upload.FileName,
+		CreatedAt: time.Now(),
+		State:     db.FileStateNew,
+		Size:      upload.Size,
+		RequestID: getRequestInfo(ctx).ID,
+	}
+
+	if err = s.db.CompleteUpload(*upload, fileData); err != nil {
+		if rErr := os.Rename(fullFilePath, s.uploadPath(upload.ID)); rErr != nil {
+			ctxLogger(ctx, &s.logger).Error().Err(rErr).Str("id", upload.ID).Msg("failed to move uploaded file back")
+		}
+		return fmt.Errorf("failed to store file metadata in database: %w", err)
+	}
+
+	s.uploadLocks.Delete(upload.ID)
+	s.publishFileEvent(EventFileAdded, upload.OwnerAddr+":"+upload.FileName, &fileData)
+
+	ctxLogger(ctx, &s.logger).Debug().Str("id", upload.ID).Str("addr", upload.OwnerAddr).Str("file", upload.FileName).Msg("upload completed")
+	return nil
+}
+
+func (s *Service) removeUpload(upload *db.Upload) error {
+	if err := os.Remove(s.uploadPath(upload.ID)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove file on disk: %w", err)
+	}
+
+	if err := s.db.DeleteUpload(upload.OwnerAddr, upload.ID); err != nil {
+		return fmt.Errorf("failed to delete upload from database: %w", err)
+	}
+	s.uploadLocks.Delete(upload.ID)
+	return nil
+}
+
+func (s *Service) doExpireUploads() {
+	list, err := s.db.GetExpiredUploads()
+	if err != nil {
+		s.logger.Error().Err(err).Msg("failed to get expired uploads")
+		return
+	}
+
+	for _, upload := range list {
+		if s.stopping() {
+			return
+		}
+
+		locked, unlock, err := s.lockUpload(upload.OwnerAddr, upload.ID)
+		if err != nil {
+			// chunk is being received right now, so it is not abandoned
+			continue
+		}
+
+		if locked.ExpiresAt.After(time.Now()) {
+			// chunk was received while we were getting the lock
+			unlock()
+			continue
+		}
+
+		if err = s.removeUpload(locked); err != nil {
+			s.logger.Error().Err(err).Str("id", upload.ID).Msg("failed to remove expired upload")
+		} else {
+			s.logger.Debug().Str("id", upload.ID).Str("addr", upload.OwnerAddr).Msg("expired upload removed")
+		}
+		unlock()
+	}
+}
+
+// lockUpload locks existing upload and returns its state read under the lock. Lock is created only
+// for upload which exists, and is removed together with the upload, so unknown ids do not grow the map
+func (s *Service) lockUpload(userAddr, id string) (*db.Upload, func(), error) {
+	upload, err := s.db.GetUpload(userAddr, id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get upload: %w", err)
+	}
+	if upload == nil {
+		return nil, nil, ErrUploadNotFound
+	}
+
+	v, _ := s.uploadLocks.LoadOrStore(id, &sync.Mutex{})
+	mx := v.(*sync.Mutex)
+	if !mx.TryLock() {
+		return nil, nil, ErrUploadBusy
+	}
+
+	// upload could be completed or removed by the previous lock holder
+	upload, err = s.db.GetUpload(userAddr, id)
+	if err != nil || upload == nil {
+		s.uploadLocks.CompareAndDelete(id, mx)
+		mx.Unlock()
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to get upload: %w", err)
+		}
+		return nil, nil, ErrUploadNotFound
+	}
+	return upload, mx.Unlock, nil
+}
+
+func (s *Service) uploadsDir() string {
+	// user directories are named by address, so it cannot intersect with them
+	return filepath.Join(s.storageBaseDir, ".uploads")
+}
+
+func (s *Service) uploadPath(id string) string {
+	return filepath.Join(s.uploadsDir(), id)
+}
@@ -0,0 +1,173 @@
+package backend
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/xssnick/ton-provider-web/frontend"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// vite puts hashed bundles into assets dir, so they never change under the same name
+const webAssetsPrefix = "/assets/"
+
+type webFile struct {
+	data        []byte
+	gzipped     []byte
+	etag        string
+	contentType string
+}
+
+// webApp serves built frontend, unknown paths are answered with index.html for client side routing
+type webApp struct {
+	fsys fs.FS
+	// cache is used for embedded files, they cannot change while running
+	cache bool
+	files sync.Map
+}
+
+// newWebApp serves app from the directory when it is set, or embedded build otherwise
+func newWebApp(dir string) *webApp {
+	if dir != "" {
+		return &webApp{fsys: os.DirFS(dir)}
+	}
+	return &webApp{fsys: frontend.Dist(), cache: true}
+}
+
+// available checks that app was built and has entry point
+func (a *webApp) available() bool {
+	_, err := fs.Stat(a.fsys, "index.html")
+	return err == nil
+}
+
+func (s *Server) webHandler(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		writeError(w, "Not found", http.StatusNotFound)
+		return
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = "index.html"
+	}
+
+	file, err := s.web.load(name)
+	if errors.Is(err, fs.ErrNotExist) && !strings.HasPrefix("/"+name, webAssetsPrefix) {
+		// SPA fallback, missing bundles are not replaced to not confuse browser with html instead of script
+		name = "index.html"
+		file, err = s.web.load(name)
+	}
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			writeError(w, "Not found", http.StatusNotFound)
+			return
+		}
+		s.log(r).Error().Err(err).Str("name", name).Msg("Failed to load web file")
+		writeError(w, "Failed to load file", http.StatusInternalServerError)
+		return
+	}
+
+	h := w.Header()
+	if strings.HasPrefix("/"+name, webAssetsPrefix) {
+		h.Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		// html and public files should be revalidated, so new release is picked up right away
+		h.Set("Cache-Control", "no-cache")
+	}
+	h.Set("Content-Type", file.contentType)
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("X-Frame-Options", "DENY")
+	h.Set("Vary", "Accept-Encoding")
+
+	data, etag := file.data, file.etag
+	if file.gzipped != nil && acceptsGzip(r) {
+		h.Set("Content-Encoding", "gzip")
+		data, etag = file.gzipped, file.etag[:len(file.etag)-1]+`-gz"`
+	}
+	h.Set("ETag", etag)
+
+	// conditional and range requests are handled by ServeContent using etag
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(data))
+}
+
+func (a *webApp) load(name string) (*webFile, error) {
+	if a.cache {
+		if f, ok := a.files.Load(name); ok {
+			return f.(*webFile), nil
+		}
+	}
+
+	st, err := fs.Stat(a.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	if st.IsDir() {
+		return nil, fs.ErrNotExist
+	}
+
+	data, err := fs.ReadFile(a.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(data)
+	file := &webFile{
+		data:        data,
+		etag:        `"` + hex.EncodeToString(hash[:16]) + `"`,
+		contentType: mime.TypeByExtension(path.Ext(name)),
+	}
+	if file.contentType == "" {
+		file.contentType = http.DetectContentType(data)
+	}
+
+	if compressible(file.contentType) && len(data) > 1024 {
+		buf := &bytes.Buffer{}
+		gz, _ := gzip.NewWriterLevel(buf, gzip.BestCompression)
+		if _, err = gz.Write(data); err == nil && gz.Close() == nil && buf.Len() < len(data) {
+			file.gzipped = buf.Bytes()
+		}
+	}
+
+	if a.cache {
+		a.files.Store(name, file)
+	}
+	return file, nil
+}
+
+func compressible(contentType string) bool {
+	ct, _, _ := strings.Cut(contentType, ";")
+	switch {
+	case strings.HasPrefix(ct, "text/"),
+		ct == "application/javascript",
+		ct == "application/json",
+		ct == "application/manifest+json",
+		ct == "image/svg+xml",
+		ct == "application/wasm":
+		return true
+	}
+	return false
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		enc, params, _ := strings.Cut(strings.TrimSpace(enc), ";")
+		if enc == "gzip" && strings.TrimSpace(params) != "q=0" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,294 @@
+package backend
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/xssnick/ton-provider-web/internal/backend/db"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const maxWebhooksPerUser = 10
+
+// webhookEvents are events which can be sent to webhooks, they follow file from upload to removal:
+// file_added (processing), bag_created (waiting for deploy), contract_deployed (stored),
+// provider_error and file_removed
+var webhookEvents = []string{EventFileAdded, EventBagCreated, EventContractDeployed, EventProviderError, EventFileRemoved}
+
+var (
+	ErrWebhookNotFound  = errors.New("webhook not found")
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+)
+
+type WebhookParams struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+}
+
+type WebhookInfo struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Secret is returned only once, on creation
+	Secret string `json:"secret,omitempty"`
+}
+
+// WebhookEvent is the body of the webhook request, ID is the same for all deliveries of the event,
+// so receiver can skip duplicates
+type WebhookEvent struct {
+	ID       string        `json:"id"`
+	Type     string        `json:"type"`
+	UserAddr string        `json:"user_addr"`
+	FileName string        `json:"file_name"`
+	At       time.Time     `json:"at"`
+	File     *UserFileInfo `json:"file,omitempty"`
+}
+
+func toWebhookInfo(w *db.Webhook) WebhookInfo {
+	events := w.Events
+	if len(events) == 0 {
+		events = webhookEvents
+	}
+
+	return WebhookInfo{
+		ID:        w.ID,
+		URL:       w.URL,
+		Events:    events,
+		CreatedAt: w.CreatedAt,
+	}
+}
+
+func (s *Service) CreateWebhook(ctx context.Context, userAddr string, params WebhookParams) (*WebhookInfo, error) {
+	if err := validateWebhookURL(params.URL); err != nil {
+		return nil, err
+	}
+	if err := s.hooks.checkURL(ctx, params.URL); err != nil {
+		return nil, err
+	}
+	for _, ev := range params.Events {
+		if !slices.Contains(webhookEvents, ev) {
+			return nil, fmt.Errorf("%w: unknown event %s", ErrInvalidInput, ev)
+		}
+	}
+
+	existing, err := s.db.GetWebhooksByUser(userAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhooks: %w", err)
+	}
+	if len(existing) >= maxWebhooksPerUser {
+		return nil, fmt.Errorf("%w: too many webhooks, remove unused first", ErrQuotaExceeded)
+	}
+
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+	if _, err = rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate webhook id: %w", err)
+	}
+	if _, err = rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+
+	w := db.Webhook{
+		ID:        hex.EncodeToString(id),
+		OwnerAddr: userAddr,
+		URL:       params.URL,
+		Secret:    hex.EncodeToString(secret),
+		Events:    slices.Compact(slices.Sorted(slices.Values(params.Events))),
+		CreatedAt: time.Now(),
+	}
+
+	if err = s.db.CreateWebhook(w); err != nil {
+		return nil, fmt.Errorf("failed to store webhook: %w", err)
+	}
+
+	info := toWebhookInfo(&w)
+	info.Secret = w.Secret
+	return &info, nil
+}
+
+func (s *Service) ListWebhooks(userAddr string) ([]WebhookInfo, error) {
+	list, err := s.db.GetWebhooksByUser(userAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhooks: %w", err)
+	}
+
+	res := make([]WebhookInfo, 0, len(list))
+	for i := range list {
+		res = append(res, toWebhookInfo(&list[i]))
+	}
+	return res, nil
+}
+
+func (s *Service) RemoveWebhook(userAddr, id string) error {
+	w, err := s.db.GetWebhook(userAddr, id)
+	if err != nil {
+		return fmt.Errorf("failed to get webhook: %w", err)
+	}
+	if w == nil {
+		return ErrWebhookNotFound
+	}
+
+	if err = s.db.DeleteWebhook(userAddr, id); err != nil {
+		return fmt.Errorf("failed to remove webhook: %w", err)
+	}
+	return nil
+}
+
+// ListWebhookDeliveries returns deliveries of the webhook from newest to oldest, before is the time of the last entry of the previous page
+func (s *Service) ListWebhookDeliveries(userAddr, id string, before time.Time, limit int) ([]NotificationInfo, error) {
+	if limit <= 0 {
+		limit = notifyDefaultLimit
+	}
+	if limit > maxNotifyLimit {
+		limit = maxNotifyLimit
+	}
+
+	w, err := s.db.GetWebhook(userAddr, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook: %w", err)
+	}
+	if w == nil {
+		return nil, ErrWebhookNotFound
+	}
+
+	list, err := s.db.GetNotifications(userAddr, id, before, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve deliveries: %w", err)
+	}
+
+	res := make([]NotificationInfo, 0, len(list))
+	for i := range list {
+		res = append(res, toNotificationInfo(&list[i]))
+	}
+	return res, nil
+}
+
+// RedeliverWebhook queues the same event again as a new delivery, event id in the payload is kept
+func (s *Service) RedeliverWebhook(userAddr, deliveryID string) (*NotificationInfo, error) {
+	old, err := s.db.GetNotification(userAddr, deliveryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get delivery: %w", err)
+	}
+	if old == nil || old.Channel != ChannelEndpoint {
+		return nil, ErrDeliveryNotFound
+	}
+
+	w, err := s.db.GetWebhook(userAddr, old.WebhookID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook: %w", err)
+	}
+	if w == nil {
+		return nil, ErrWebhookNotFound
+	}
+
+	id := make([]byte, 8)
+	if _, err = rand.Read(id); err != nil {
+		return nil, fmt.Errorf("failed to generate delivery id: %w", err)
+	}
+
+	now := time.Now()
+	n := db.Notification{
+		ID:        hex.EncodeToString(id),
+		UserAddr:  userAddr,
+		Channel:   ChannelEndpoint,
+		Event:     old.Event,
+		FileName:  old.FileName,
+		Payload:   old.Payload,
+		WebhookID: old.WebhookID,
+		Status:    db.NotificationPending,
+		NextAt:    now,
+		CreatedAt: now,
+	}
+
+	if err = s.db.AddNotification(n, notifyRetention); err != nil {
+		return nil, fmt.Errorf("failed to store delivery: %w", err)
+	}
+
+	info := toNotificationInfo(&n)
+	return &info, nil
+}
+
+// queueWebhookEvent stores delivery of the event for every webhook of the user subscribed to it,
+// failure is only logged, because the file state is already changed at this point
+func (s *Service) queueWebhookEvent(userAddr string, ev FileEvent) {
+	if !slices.Contains(webhookEvents, ev.Type) {
+		return
+	}
+
+	hooks, err := s.db.GetWebhooksByUser(userAddr)
+	if err != nil {
+		s.logger.Error().Err(err).Str("addr", userAddr).Msg("failed to get webhooks")
+		return
+	}
+	if len(hooks) == 0 {
+		return
+	}
+
+	evID := make([]byte, 8)
+	_, _ = rand.Read(evID)
+
+	payload, err := json.Marshal(WebhookEvent{
+		ID:       hex.EncodeToString(evID),
+		Type:     ev.Type,
+		UserAddr: userAddr,
+		FileName: ev.FileName,
+		At:       ev.At,
+		File:     ev.File,
+	})
+	if err != nil {
+		s.logger.Error().Err(err).Str("addr", userAddr).Msg("failed to marshal webhook event")
+		return
+	}
+
+	for _, w := range hooks {
+		if len(w.Events) > 0 && !slices.Contains(w.Events, ev.Type) {
+			continue
+		}
+
+		id := make([]byte, 8)
+		_, _ = rand.Read(id)
+
+		n := db.Notification{
+			ID:        hex.EncodeToString(id),
+			UserAddr:  userAddr,
+			Channel:   ChannelEndpoint,
+			Event:     ev.Type,
+			FileName:  ev.FileName,
+			Payload:   payload,
+			WebhookID: w.ID,
+			Status:    db.NotificationPending,
+			NextAt:    ev.At,
+			CreatedAt: ev.At,
+		}
+
+		if err = s.db.AddNotification(n, notifyRetention); err != nil {
+			s.logger.Error().Err(err).Str("addr", userAddr).Str("webhook", w.ID).Str("event", ev.Type).Msg("failed to queue webhook event")
+		}
+	}
+}
+
+// deliverWebhookEvent sends event to the webhook, stored url is checked again before every delivery,
+// delivery of removed webhook is not retried
+func (s *Service) deliverWebhookEvent(ctx context.Context, n *db.Notification) error {
+	w, err := s.db.GetWebhook(n.UserAddr, n.WebhookID)
+	if err != nil {
+		return fmt.Errorf("failed to get webhook: %w", err)
+	}
+	if w == nil {
+		n.Attempts = notifyMaxAttempts
+		return ErrWebhookNotFound
+	}
+
+	return s.postWebhook(ctx, w.URL, n.Payload, map[string]string{
+		"X-Webhook-ID":      n.ID,
+		"X-Webhook-Event":   n.Event,
+		"X-Webhook-Attempt": strconv.Itoa(n.Attempts),
+	}, w.Secret)
+}